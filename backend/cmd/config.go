@@ -2,10 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
 	"os"
 	"time"
 
 	"github.com/relseah/parken"
+	"github.com/relseah/parken/web"
 )
 
 type duration time.Duration
@@ -24,14 +29,83 @@ func (d *duration) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+type rateLimit struct {
+	Requests int
+	Interval duration
+	Burst    int
+}
+
+func (l rateLimit) validate() error {
+	if l.Requests < 0 || l.Burst < 0 || l.Interval < 0 {
+		return errors.New("negative rate limit")
+	}
+	if l.Requests != 0 && l.Interval == 0 {
+		return errors.New("rate limit without interval")
+	}
+	return nil
+}
+
+func (l rateLimit) web() web.RateLimit {
+	return web.RateLimit{Requests: l.Requests, Interval: time.Duration(l.Interval), Burst: l.Burst}
+}
+
+// parsePrefixes parses addresses and networks in CIDR notation.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, len(values))
+	for i, v := range values {
+		if addr, err := netip.ParseAddr(v); err == nil {
+			prefixes[i] = netip.PrefixFrom(addr, addr.BitLen())
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes[i] = prefix.Masked()
+	}
+	return prefixes, nil
+}
+
 type config struct {
 	Web struct {
 		Address      string
 		ReadTimeout  duration
 		WriteTimeout duration
+		// Tiles is the directory of the map tiles. It defaults to the
+		// directory tiles next to the executable.
+		Tiles string
+		// MaxSubscribers limits the number of clients of the event stream.
+		MaxSubscribers int
+		RateLimiting   struct {
+			// PerIP limits the requests of each client IP and PerKey the
+			// ones made with each API key.
+			PerIP, PerKey rateLimit
+			// TrustedProxies are the addresses or networks of reverse
+			// proxies, whose X-Forwarded-For header is trusted.
+			TrustedProxies []string
+		}
+		CORS struct {
+			// AllowedOrigins may contain * to allow all origins or a * in
+			// the host to allow subdomains.
+			AllowedOrigins []string
+			AllowedMethods []string
+			// MaxAge is the time for which preflight responses are cached.
+			MaxAge duration
+		}
+	}
+	API struct {
+		// Keys maps the names of the consumers of the API to their keys.
+		Keys map[string]struct {
+			Key string
+			// DailyQuota limits the requests per day. It is unlimited if 0.
+			DailyQuota int
+		}
 	}
 	Scraping struct {
 		Interval duration
+		// StaleIntervals is the number of intervals without a successful
+		// scrape, after which the server is not ready anymore.
+		StaleIntervals int
 	}
 	Coordinates struct {
 		Nominatim struct {
@@ -43,7 +117,28 @@ type config struct {
 		Presets map[int]parken.Coordinates
 	}
 	Database struct {
+		// Backend is mysql, sqlite or memory and defaults to mysql. The data
+		// source name of sqlite is the path of the database file.
+		Backend        string
 		DataSourceName string
+		// ManualMigrations prevents migrating the schema on startup, which
+		// fails instead if the schema is outdated. The schema is migrated by
+		// parken migrate then.
+		ManualMigrations bool
+	}
+	Prediction struct {
+		URL string
+	}
+	Admin struct {
+		// Keys maps the names of the keys of the admin API to their secrets.
+		// The admin API is disabled if there are none.
+		Keys map[string]string
+	}
+	Logging struct {
+		// Level is one of DEBUG, INFO, WARN and ERROR.
+		Level string
+		// Format is either text or json.
+		Format string
 	}
 }
 
@@ -52,7 +147,71 @@ func readConfig(path string) (*config, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 	dec := json.NewDecoder(file)
 	config := &config{}
-	return config, dec.Decode(config)
+	if err := dec.Decode(config); err != nil {
+		return nil, err
+	}
+	return config, config.validate()
+}
+
+// validate checks the values that cannot be checked while decoding.
+func (c *config) validate() error {
+	if c.Scraping.Interval < 0 {
+		return errors.New("negative scraping interval")
+	}
+	nominatim := c.Coordinates.Nominatim.RateLimiting
+	if nominatim.Rate < 0 || nominatim.Interval < 0 {
+		return errors.New("negative rate limit")
+	}
+	if nominatim.Rate != 0 && nominatim.Interval == 0 {
+		return errors.New("rate limit without interval")
+	}
+	for id, coordinates := range c.Coordinates.Presets {
+		if coordinates.Latitude < -90 || coordinates.Latitude > 90 ||
+			coordinates.Longitude < -180 || coordinates.Longitude > 180 {
+			return fmt.Errorf("preset of parking with ID %d out of range", id)
+		}
+	}
+	rateLimiting := &c.Web.RateLimiting
+	if err := rateLimiting.PerIP.validate(); err != nil {
+		return err
+	}
+	if err := rateLimiting.PerKey.validate(); err != nil {
+		return err
+	}
+	if _, err := parsePrefixes(rateLimiting.TrustedProxies); err != nil {
+		return fmt.Errorf("parsing trusted proxies: %w", err)
+	}
+	keys := make(map[string]bool)
+	for consumer, key := range c.API.Keys {
+		if key.Key == "" || keys[key.Key] {
+			return fmt.Errorf("empty or duplicate API key of %s", consumer)
+		}
+		if key.DailyQuota < 0 {
+			return fmt.Errorf("negative quota of %s", consumer)
+		}
+		keys[key.Key] = true
+	}
+	if c.Web.CORS.MaxAge < 0 {
+		return errors.New("negative maximum age of preflight responses")
+	}
+	switch c.Database.Backend {
+	case "", "mysql", "sqlite", "memory":
+	default:
+		return fmt.Errorf("unknown database backend %q", c.Database.Backend)
+	}
+	if c.Logging.Level != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+			return err
+		}
+	}
+	switch c.Logging.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unknown logging format %q", c.Logging.Format)
+	}
+	return nil
 }
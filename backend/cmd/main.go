@@ -2,90 +2,197 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/relseah/parken/frontend"
 	"github.com/relseah/parken/nominatim"
 	"github.com/relseah/parken/scraping"
+	"github.com/relseah/parken/store"
 	"github.com/relseah/parken/web"
 )
 
-func openDB(config *config) (*sql.DB, error) {
-	db, err := sql.Open("mysql", config.Database.DataSourceName)
+// openStore opens the store of the configured backend.
+func openStore(config *config) (store.Store, error) {
+	dataSourceName := config.Database.DataSourceName
+	switch config.Database.Backend {
+	case "", "mysql":
+		return store.OpenMySQL(dataSourceName)
+	case "sqlite":
+		return store.OpenSQLite(dataSourceName)
+	case "memory":
+		return store.NewMemory(), nil
+	}
+	return nil, fmt.Errorf("unknown backend %q", config.Database.Backend)
+}
+
+// tilesPath returns the configured directory of the map tiles or the directory
+// tiles next to the executable, so that the server does not depend on the
+// working directory.
+func tilesPath(config *config) (string, error) {
+	if config.Web.Tiles != "" {
+		return config.Web.Tiles, nil
+	}
+	executable, err := os.Executable()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer func() {
-		if err != nil {
-			db.Close()
-		}
-	}()
-	err = db.Ping()
+	return filepath.Join(filepath.Dir(executable), "tiles"), nil
+}
+
+// migrateStore migrates the schema of the store to the latest version. If
+// migrations are manual, it fails instead if the schema is outdated.
+func migrateStore(st store.Store, config *config, logger *slog.Logger) error {
+	m, ok := st.(store.Migrator)
+	if !ok {
+		return nil
+	}
+	ctx := context.Background()
+	current, latest, err := m.SchemaVersion(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	rows, err := db.Query("SELECT 1 FROM information_schema.schemata WHERE schema_name = 'parken';")
+	if current == latest {
+		return nil
+	}
+	if config.Database.ManualMigrations {
+		return fmt.Errorf("schema version is %d instead of %d, run parken migrate", current, latest)
+	}
+	logger.Info("migrating schema", "from", current, "to", latest)
+	return m.Migrate(ctx, latest, false)
+}
+
+// runMigrate migrates the schema to the version given by the only argument or
+// the latest version if there is none. Reverting migrations that drop data
+// requires the flag -force.
+func runMigrate(config *config, args []string, logger *slog.Logger) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	force := flags.Bool("force", false, "revert migrations even if they drop data")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) > 1 {
+		return errors.New("usage: parken migrate [-force] [version]")
+	}
+	st, err := openStore(config)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("opening store: %w", err)
 	}
-	initialized := rows.Next()
-	if err := rows.Err(); err != nil && err != sql.ErrNoRows {
-		return nil, err
+	defer st.Close()
+	m, ok := st.(store.Migrator)
+	if !ok {
+		return fmt.Errorf("backend %s has no schema", config.Database.Backend)
 	}
-	if !initialized {
-		if err = initializeDB(db); err != nil {
-			return nil, err
+	ctx := context.Background()
+	current, latest, err := m.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	version := latest
+	if len(args) == 1 {
+		if version, err = strconv.Atoi(args[0]); err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
 		}
-	} else {
-		if err := selectDefaultDatabase(db); err != nil {
-			return nil, err
+		if version < 0 || version > latest {
+			return fmt.Errorf("unknown version %d, the latest one is %d", version, latest)
 		}
 	}
-	return db, nil
+	if current == version {
+		logger.Info("schema is up to date", "version", current)
+		return nil
+	}
+	logger.Info("migrating schema", "from", current, "to", version)
+	err = m.Migrate(ctx, version, *force)
+	if errors.Is(err, store.ErrDestructive) {
+		return fmt.Errorf("%w; pass -force to revert it anyway", err)
+	}
+	return err
 }
 
-func selectDefaultDatabase(db *sql.DB) error {
-	if _, err := db.Exec("USE parken"); err != nil {
-		return fmt.Errorf("selecting default database: %w", err)
+func newLogger(config *config, level *slog.LevelVar) (*slog.Logger, error) {
+	if config.Logging.Level != "" {
+		if err := level.UnmarshalText([]byte(config.Logging.Level)); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	options := &slog.HandlerOptions{Level: level}
+	switch config.Logging.Format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, options)), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", config.Logging.Format)
+}
+
+// reloader rereads the configuration and applies the settings that can be
+// changed at runtime.
+type reloader struct {
+	mutex  sync.Mutex
+	path   string
+	config *config
+	level  *slog.LevelVar
+	server *web.Server
+	client *nominatim.Client
+	logger *slog.Logger
 }
 
-func initializeDB(db *sql.DB) error {
-	log.Println("Initializing database...")
-	if _, err := db.Exec("CREATE DATABASE parken;"); err != nil {
-		return fmt.Errorf("creating database: %w", err)
+func (r *reloader) reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	config, err := readConfig(r.path)
+	if err != nil {
+		return fmt.Errorf("reading configuration: %w", err)
 	}
-	if err := selectDefaultDatabase(db); err != nil {
-		return err
+	old := r.config
+	if !reflect.DeepEqual(config.Web, old.Web) || !reflect.DeepEqual(config.API, old.API) || config.Database != old.Database || config.Prediction != old.Prediction ||
+		config.Logging.Format != old.Logging.Format || !reflect.DeepEqual(config.Admin, old.Admin) ||
+		config.Scraping.StaleIntervals != old.Scraping.StaleIntervals {
+		r.logger.Warn("some changes of the configuration take effect after a restart only")
+	}
+	// The presets are applied first, as they are the only change that can
+	// fail, so that a failed reload changes nothing and is retried in full by
+	// the next one.
+	if !reflect.DeepEqual(config.Coordinates.Presets, old.Coordinates.Presets) {
+		if err := r.server.ReloadCoordinates(config.Coordinates.Presets); err != nil {
+			return fmt.Errorf("reloading coordinates: %w", err)
+		}
 	}
-	query := `CREATE TABLE spots (
-parking_id INT NOT NULL,
-time DATETIME NOT NULL,
-free INT,
-PRIMARY KEY (parking_id, time));`
-	if _, err := db.Exec(query); err != nil {
-		return fmt.Errorf("creating spots table: %w", err)
-	}
-	query = `CREATE TABLE coordinates (
-parking_id INT NOT NULL,
-latitude DOUBLE NOT NULL,
-longitude DOUBLE NOT NULL,
-PRIMARY KEY (parking_id));`
-	if _, err := db.Exec(query); err != nil {
-		return fmt.Errorf("creating coordinates table: %w", err)
+	level := slog.LevelInfo
+	if config.Logging.Level != "" {
+		// The level has been validated by readConfig.
+		level.UnmarshalText([]byte(config.Logging.Level))
 	}
+	r.level.Set(level)
+	if config.Coordinates.Nominatim.RateLimiting != old.Coordinates.Nominatim.RateLimiting {
+		rateLimiting := config.Coordinates.Nominatim.RateLimiting
+		r.client.SetRate(rateLimiting.Rate, time.Duration(rateLimiting.Interval))
+	}
+	if config.Scraping.Interval != old.Scraping.Interval {
+		r.server.ScheduleScraping(time.Duration(config.Scraping.Interval))
+	}
+	r.config = config
+	r.logger.Info("configuration reloaded")
 	return nil
 }
 
-func runServer(config *config) error {
+func runServer(configPath string, config *config, frontendPath string, level *slog.LevelVar, logger *slog.Logger) error {
 	interrupted := false
 	close := func(c io.Closer) {
 		if !interrupted {
@@ -100,21 +207,51 @@ func runServer(config *config) error {
 	}
 	httpServer := &http.Server{Addr: addr, ReadTimeout: time.Duration(config.Web.ReadTimeout),
 		WriteTimeout: time.Duration(config.Web.WriteTimeout)}
-	scraper := new(scraping.Scraper)
+	scraper := &scraping.Scraper{Logger: logger}
 
-	db, err := openDB(config)
+	st, err := openStore(config)
 	if err != nil {
-		return fmt.Errorf("opening database: %w", err)
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer close(st)
+	if err := migrateStore(st, config, logger); err != nil {
+		return fmt.Errorf("migrating schema: %w", err)
 	}
-	defer close(db)
 
 	client := nominatim.NewClient(config.Coordinates.Nominatim.RateLimiting.Rate, time.Duration(config.Coordinates.Nominatim.RateLimiting.Interval))
-	log.Println("Initializing server...")
-	server, err := web.NewServer(httpServer, scraper, time.Duration(config.Scraping.Interval), config.Coordinates.Presets, client, db, log.Default())
+	client.Logger = logger
+	var frontendFS fs.FS = frontend.FS
+	if frontendPath != "" {
+		frontendFS = os.DirFS(frontendPath)
+	}
+	logger.Info("initializing server")
+	server, err := web.NewServer(httpServer, frontendFS, scraper, time.Duration(config.Scraping.Interval), config.Coordinates.Presets, client, st, logger)
 	if err != nil {
 		return fmt.Errorf("initializing server: %w", err)
 	}
 	defer close(server)
+	server.MaxSubscribers = config.Web.MaxSubscribers
+	if server.TilesPath, err = tilesPath(config); err != nil {
+		return fmt.Errorf("locating tiles: %w", err)
+	}
+	server.StaleIntervals = config.Scraping.StaleIntervals
+	reloader := &reloader{path: configPath, config: config, level: level, server: server, client: client, logger: logger}
+	server.Reload, server.AdminKeys = reloader.reload, config.Admin.Keys
+	server.RateLimit, server.KeyRateLimit = config.Web.RateLimiting.PerIP.web(), config.Web.RateLimiting.PerKey.web()
+	// The trusted proxies have been validated by readConfig.
+	server.TrustedProxies, _ = parsePrefixes(config.Web.RateLimiting.TrustedProxies)
+	server.APIKeys = make(map[string]web.APIKey)
+	for consumer, key := range config.API.Keys {
+		server.APIKeys[key.Key] = web.APIKey{Consumer: consumer, DailyQuota: key.DailyQuota}
+	}
+	cors := config.Web.CORS
+	server.CORS = web.CORS{AllowedOrigins: cors.AllowedOrigins, AllowedMethods: cors.AllowedMethods, MaxAge: time.Duration(cors.MaxAge)}
+	if config.Prediction.URL != "" {
+		server.PredictionURL, err = url.Parse(config.Prediction.URL)
+		if err != nil {
+			return fmt.Errorf("parsing URL of prediction service: %w", err)
+		}
+	}
 
 	e := make(chan error)
 	go func() {
@@ -122,42 +259,71 @@ func runServer(config *config) error {
 	}()
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
-	log.Println("Server running.")
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	logger.Info("server running", "address", addr)
 
-	select {
-	case err = <-e:
-		return err
-	case <-interrupt:
-		interrupted = true
-		log.Println("Closing database connection...")
-		err = server.SetDB(nil)
-		if err != nil {
-			log.Println(err)
-		}
-		err = db.Close()
-		if err != nil {
-			log.Println(err)
-		}
-		log.Println("Shutting down server...")
-		err = server.Shutdown(context.Background())
-		if err != nil {
-			log.Println(err)
+	for {
+		select {
+		case err = <-e:
+			return err
+		case <-hangup:
+			if err := reloader.reload(); err != nil {
+				logger.Error("reloading configuration failed", "error", err)
+			}
+		case <-interrupt:
+			interrupted = true
+			logger.Info("closing store")
+			server.SetStore(nil)
+			err = st.Close()
+			if err != nil {
+				logger.Error("closing store", "error", err)
+			}
+			logger.Info("shutting down server")
+			err = server.Shutdown(context.Background())
+			if err != nil {
+				logger.Error("shutting down server", "error", err)
+			}
+			return nil
 		}
-		return nil
 	}
 }
 
 func main() {
-	var configPath string
+	var configPath, frontendPath string
 	flag.StringVar(&configPath, "configuration", "config.json", "path to configuration")
+	flag.StringVar(&frontendPath, "frontend", "", "serve the frontend from this directory instead of the embedded files")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate [-force] [version]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
+	if flag.NArg() > 0 && flag.Arg(0) != "migrate" {
+		flag.Usage()
+		os.Exit(2)
+	}
 
 	config, err := readConfig(configPath)
 	if err != nil {
 		log.Fatalln("reading configuration:", err)
 	}
+	level := new(slog.LevelVar)
+	logger, err := newLogger(config, level)
+	if err != nil {
+		log.Fatalln("configuring logging:", err)
+	}
+	// Records of the log package are passed to the logger as well.
+	slog.SetDefault(logger)
 
-	if err = runServer(config); err != nil {
-		log.Fatalln(err)
+	if flag.Arg(0) == "migrate" {
+		if err = runMigrate(config, flag.Args()[1:], logger); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if err = runServer(configPath, config, frontendPath, level, logger); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 }
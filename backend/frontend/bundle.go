@@ -0,0 +1,55 @@
+//go:build bundle
+
+package frontend
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"regexp"
+	"sync"
+	"testing/fstest"
+)
+
+//go:embed index.html parken.css parken.min.js
+//go:embed leaflet/leaflet.css leaflet/images
+//go:embed fontawesome/LICENSE.txt fontawesome/css fontawesome/webfonts fonts
+var files embed.FS
+
+// bundled matches the scripts in index.html that are contained in the bundle.
+var bundled = regexp.MustCompile(`(?s)<!-- bundle:.*?<!-- end of bundle -->`)
+
+// FS contains the files of the frontend, which are served below /static/
+// except for index.html. Its index.html loads the bundle instead of the
+// scripts contained in it.
+var FS fs.FS = bundleFS{}
+
+type bundleFS struct{}
+
+var (
+	indexOnce sync.Once
+	index     fstest.MapFS
+	indexErr  error
+)
+
+func (bundleFS) Open(name string) (fs.File, error) {
+	if name != "index.html" {
+		return files.Open(name)
+	}
+	indexOnce.Do(func() {
+		data, err := files.ReadFile(name)
+		if err == nil && !bundled.Match(data) {
+			err = errors.New("the scripts of the bundle are not marked")
+		}
+		if err != nil {
+			indexErr = &fs.PathError{Op: "open", Path: name, Err: err}
+			return
+		}
+		data = bundled.ReplaceAll(data, []byte(`<script defer src="static/parken.min.js"></script>`))
+		index = fstest.MapFS{name: &fstest.MapFile{Data: data, Mode: 0444}}
+	})
+	if indexErr != nil {
+		return nil, indexErr
+	}
+	return index.Open(name)
+}
@@ -0,0 +1,20 @@
+//go:build !bundle
+
+// Package frontend embeds the files of the web frontend. Production builds
+// use the build tag bundle, which embeds the scripts as a single minified
+// bundle generated by go generate.
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed index.html parken.css parken.js L.Control.Locate.js L.ElementIcon.js
+//go:embed leaflet/leaflet.js leaflet/leaflet.css leaflet/images
+//go:embed fontawesome/LICENSE.txt fontawesome/css fontawesome/webfonts fonts
+var files embed.FS
+
+// FS contains the files of the frontend, which are served below /static/
+// except for index.html.
+var FS fs.FS = files
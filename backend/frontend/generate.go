@@ -0,0 +1,9 @@
+package frontend
+
+// Production builds with the build tag bundle embed parken.min.js, which is
+// generated from the scripts between the bundle comments of index.html by
+// uglifyjs (npm install --global uglify-js). It is not checked in, so go build
+// -tags bundle fails with "pattern parken.min.js: no matching files found"
+// until go generate has been run.
+//
+//go:generate uglifyjs leaflet/leaflet.js L.Control.Locate.js L.ElementIcon.js parken.js -c -m --toplevel -o parken.min.js
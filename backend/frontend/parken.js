@@ -270,6 +270,7 @@ function convertToElement(parking) {
 	let nameStrong = createNameStrong(parking);
 	nameStrong.onclick = () => {
 		highlightParkingElement(parking.element, false);
+		if (!parking.marker) return;
 		parking.marker.togglePopup();
 		if (highlightedParkingElement) map.panTo(parking.coordinates);
 	};
@@ -332,7 +333,8 @@ let parkingsUl = document.getElementById("parkings");
 let displayedParkings;
 function displayParkings() {
 	for (parking of parkings) {
-		markParking(parking);
+		// The location of some parkings is still being looked up.
+		if (!parking.locationPending) markParking(parking);
 		parkingsUl.append(parking.element);
 	}
 	displayedParkings = [...parkings];
@@ -2,8 +2,9 @@ package nominatim
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -20,15 +21,58 @@ type place struct {
 	Longitude string `json:"lon"`
 }
 
+type reversePlace struct {
+	Error   string
+	Address struct {
+		Road         string
+		HouseNumber  string `json:"house_number"`
+		City         string
+		Town         string
+		Village      string
+		Municipality string
+		PostalCode   string `json:"postcode"`
+	}
+}
+
+var ErrStatus = errors.New("returned status does not indicate success")
+var ErrNoResult = errors.New("no result")
+
+// Stats counts the requests of a client.
+type Stats struct {
+	Searches        int
+	ReverseSearches int
+	Errors          int
+	// Waits counts the requests delayed by the rate limit and WaitTime is
+	// their total delay.
+	Waits    int
+	WaitTime time.Duration
+}
+
 type Client struct {
 	BaseURL    *url.URL
 	HTTPClient *http.Client
-	Logger     log.Logger
+	// Logger receives a debug record for each request.
+	Logger *slog.Logger
 
 	rate      int
 	remaining int
 	ticker    *time.Ticker
 	mutex     sync.Mutex
+
+	stats      Stats
+	statsMutex sync.Mutex
+}
+
+func (c *Client) Stats() Stats {
+	c.statsMutex.Lock()
+	defer c.statsMutex.Unlock()
+	return c.stats
+}
+
+func (c *Client) count(f func(*Stats)) {
+	c.statsMutex.Lock()
+	f(&c.stats)
+	c.statsMutex.Unlock()
 }
 
 func (c *Client) httpClient() *http.Client {
@@ -57,8 +101,17 @@ func (c *Client) limit() {
 	if c.remaining > 0 {
 		c.remaining--
 	} else {
+		start := time.Now()
 		<-c.ticker.C
 		reset()
+		wait := time.Since(start)
+		c.count(func(s *Stats) {
+			s.Waits++
+			s.WaitTime += wait
+		})
+		if c.Logger != nil {
+			c.Logger.Debug("rate limited", "duration", wait)
+		}
 	}
 }
 
@@ -80,29 +133,49 @@ func (c *Client) SetRate(rate int, interval time.Duration) {
 	}
 }
 
-func (c *Client) Search(parking *parken.Parking) ([]parken.Coordinates, error) {
-	u := c.BaseURL
-	if u == nil {
-		u = defaultBaseURL
-	}
-	q := u.Query()
-	if u == defaultBaseURL {
+func (c *Client) get(path string, q url.Values, v any) (err error) {
+	defer func() {
+		c.count(func(s *Stats) {
+			if path == "/reverse" {
+				s.ReverseSearches++
+			} else {
+				s.Searches++
+			}
+			if err != nil {
+				s.Errors++
+			}
+		})
+	}()
+	base := c.BaseURL
+	if base == nil {
+		base = defaultBaseURL
 		q.Set("format", "jsonv2")
 	}
-	q.Set("q", fmt.Sprintf("P%d %s, Heidelberg", parking.ID, parking.Name))
+	u := *base
+	u.Path = path
 	u.RawQuery = q.Encode()
-	u.Path = "/search"
 
 	c.limit()
+	start := time.Now()
 	resp, err := c.httpClient().Get(u.String())
 	if err != nil {
-		return nil, err
+		return err
 	}
-	dec := json.NewDecoder(resp.Body)
+	defer resp.Body.Close()
+	if c.Logger != nil {
+		c.Logger.Debug("nominatim request", "path", path, "status", resp.StatusCode, "duration", time.Since(start))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrStatus, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) Search(parking *parken.Parking) ([]parken.Coordinates, error) {
+	q := url.Values{}
+	q.Set("q", fmt.Sprintf("P%d %s, Heidelberg", parking.ID, parking.Name))
 	var results []place
-	err = dec.Decode(&results)
-	resp.Body.Close()
-	if err != nil {
+	if err := c.get("/search", q, &results); err != nil {
 		return nil, err
 	}
 	coordinates := make([]parken.Coordinates, len(results))
@@ -120,6 +193,36 @@ func (c *Client) Search(parking *parken.Parking) ([]parken.Coordinates, error) {
 	return coordinates, nil
 }
 
+// ReverseSearch looks up the address at the given coordinates.
+func (c *Client) ReverseSearch(coordinates parken.Coordinates) (parken.Address, error) {
+	q := url.Values{}
+	q.Set("lat", strconv.FormatFloat(coordinates.Latitude, 'f', -1, 64))
+	q.Set("lon", strconv.FormatFloat(coordinates.Longitude, 'f', -1, 64))
+	q.Set("addressdetails", "1")
+	var res reversePlace
+	if err := c.get("/reverse", q, &res); err != nil {
+		return parken.Address{}, err
+	}
+	if res.Error != "" {
+		return parken.Address{}, fmt.Errorf("%w: %s", ErrNoResult, res.Error)
+	}
+	address := parken.Address{Street: res.Address.Road, HouseNumber: res.Address.HouseNumber}
+	for _, town := range []string{res.Address.City, res.Address.Town, res.Address.Village, res.Address.Municipality} {
+		if town != "" {
+			address.Town = town
+			break
+		}
+	}
+	if res.Address.PostalCode != "" {
+		postalCode, err := strconv.Atoi(res.Address.PostalCode)
+		if err != nil {
+			return address, fmt.Errorf("converting postal code: %w", err)
+		}
+		address.PostalCode = postalCode
+	}
+	return address, nil
+}
+
 func NewClient(rate int, interval time.Duration) *Client {
 	c := new(Client)
 	c.SetRate(rate, interval)
@@ -16,6 +16,23 @@ func (u URL) MarshalJSON() ([]byte, error) {
 	return json.Marshal(u.String())
 }
 
+func (u *URL) UnmarshalJSON(data []byte) error {
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == nil {
+		u.URL = nil
+		return nil
+	}
+	parsed, err := url.Parse(*s)
+	if err != nil {
+		return err
+	}
+	u.URL = parsed
+	return nil
+}
+
 type Coordinates struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
@@ -28,21 +45,30 @@ type Address struct {
 	PostalCode  int    `json:"postalCode"`
 }
 
+// Complete reports whether all fields but the optional house number are set.
+func (a Address) Complete() bool {
+	return a.Street != "" && a.Town != "" && a.PostalCode != 0
+}
+
 type Parking struct {
-	ID               int         `json:"id"`
-	Name             string      `json:"name"`
-	Zone             int         `json:"zone"`
-	Operator         string      `json:"operator"`
-	Address          Address     `json:"address"`
-	Coordinates      Coordinates `json:"coordinates"`
-	PhoneNumber      string      `json:"phoneNumber"`
-	Website          URL         `json:"website"`
-	Email            string      `json:"email"`
-	Prices           string      `json:"prices"`
-	LongTermPrices   string      `json:"longTermPrices"`
-	OpeningHours     string      `json:"openingHours"`
-	OpenAllDay       bool        `json:"openAllDay"`
-	ChargingStations string      `json:"chargingStations,omitempty"`
-	Spots            int         `json:"spots"`
-	Capacity         int         `json:"capacity"`
+	ID          int         `json:"id"`
+	Name        string      `json:"name"`
+	Zone        int         `json:"zone"`
+	Operator    string      `json:"operator"`
+	Address     Address     `json:"address"`
+	Coordinates Coordinates `json:"coordinates"`
+	// LocationPending is set while the coordinates are being looked up.
+	LocationPending  bool   `json:"locationPending,omitempty"`
+	PhoneNumber      string `json:"phoneNumber"`
+	Website          URL    `json:"website"`
+	Email            string `json:"email"`
+	Prices           string `json:"prices"`
+	LongTermPrices   string `json:"longTermPrices"`
+	OpeningHours     string `json:"openingHours"`
+	OpenAllDay       bool   `json:"openAllDay"`
+	ChargingStations string `json:"chargingStations,omitempty"`
+	// Notes are added by the administrators.
+	Notes    string `json:"notes,omitempty"`
+	Spots    int    `json:"spots"`
+	Capacity int    `json:"capacity"`
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -46,11 +47,11 @@ type Result struct {
 
 var ErrAddressFormat = errors.New("invalid address format")
 
+// ParseAddress parses an address of the form "Street 1, 69117 Town". If the
+// address is malformed, the fields that could be parsed are returned along with
+// the error.
 func ParseAddress(rawAddress string) (parken.Address, error) {
 	lines := strings.Split(rawAddress, ",")
-	if len(lines) != 2 {
-		return parken.Address{}, ErrAddressFormat
-	}
 	for i := 0; i < len(lines); i++ {
 		lines[i] = strings.TrimSpace(lines[i])
 	}
@@ -66,10 +67,13 @@ func ParseAddress(rawAddress string) (parken.Address, error) {
 	if i != -1 {
 		address.HouseNumber = lines[0][i+1:]
 	}
+	if len(lines) != 2 {
+		return address, ErrAddressFormat
+	}
 
 	i = strings.Index(lines[1], " ")
 	if i == -1 {
-		return parken.Address{}, ErrAddressFormat
+		return address, ErrAddressFormat
 	}
 	address.Town = lines[1][i+1:]
 	postalCode, err := strconv.Atoi(lines[1][:i])
@@ -82,6 +86,8 @@ func ParseAddress(rawAddress string) (parken.Address, error) {
 
 type Scraper struct {
 	Client *http.Client
+	// Logger receives warnings about malformed upstream records.
+	Logger *slog.Logger
 }
 
 func (s *Scraper) client() *http.Client {
@@ -164,9 +170,10 @@ func (s *Scraper) Scrape(updated time.Time) (Result, error) {
 		if err != nil {
 			return res, fmt.Errorf("parsing ID of zone: %w", err)
 		}
+		// Incomplete addresses are completed by reverse geocoding.
 		address, err := ParseAddress(raw.Address)
-		if err != nil {
-			return res, fmt.Errorf("parsing address %s: %w", raw.Address, err)
+		if err != nil && s.Logger != nil {
+			s.Logger.Warn("malformed address", "parking_id", id, "address", raw.Address, "error", err)
 		}
 		var website parken.URL
 		if raw.Website != "" {
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+type metadataVersion struct {
+	time time.Time
+	data []byte
+}
+
+// Memory is a Store that keeps the data in memory, so that it is lost when the
+// process exits. It is meant for development and tests.
+type Memory struct {
+	mutex sync.Mutex
+	// spots holds the samples of each parking in chronological order.
+	spots       map[int][]Sample
+	coordinates map[int]parken.Coordinates
+	// metadata holds the versions of each parking in chronological order.
+	metadata  map[int][]metadataVersion
+	overrides map[int]Override
+	audit     []AuditEntry
+}
+
+func NewMemory() *Memory {
+	return &Memory{spots: make(map[int][]Sample), coordinates: make(map[int]parken.Coordinates),
+		metadata: make(map[int][]metadataVersion), overrides: make(map[int]Override)}
+}
+
+func (m *Memory) SaveSpots(updated time.Time, parkings []parken.Parking) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	updated = updated.UTC().Truncate(time.Second)
+	for _, p := range parkings {
+		samples := m.spots[p.ID]
+		i := sort.Search(len(samples), func(i int) bool { return !samples[i].Time.Before(updated) })
+		if i < len(samples) && samples[i].Time.Equal(updated) {
+			return fmt.Errorf("spots of parking with ID %d at %s exist already", p.ID, updated)
+		}
+		samples = append(samples, Sample{})
+		copy(samples[i+1:], samples[i:])
+		samples[i] = Sample{Time: updated, Free: p.Spots}
+		m.spots[p.ID] = samples
+	}
+	return nil
+}
+
+func (m *Memory) LatestUpdate() (time.Time, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var latest time.Time
+	for _, samples := range m.spots {
+		if t := samples[len(samples)-1].Time; t.After(latest) {
+			latest = t
+		}
+	}
+	return latest, nil
+}
+
+func (m *Memory) History(ids []int, from, to time.Time) ([]Sample, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	sums := make(map[time.Time]int)
+	for _, id := range ids {
+		for _, smpl := range m.spots[id] {
+			if !smpl.Time.Before(from) && smpl.Time.Before(to) {
+				sums[smpl.Time] += smpl.Free
+			}
+		}
+	}
+	var samples []Sample
+	for t, free := range sums {
+		samples = append(samples, Sample{Time: t, Free: free})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	return samples, nil
+}
+
+func (m *Memory) SamplesAt(from, at time.Time) (map[int]Sample, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	latest := make(map[int]Sample)
+	for id, samples := range m.spots {
+		i := sort.Search(len(samples), func(i int) bool { return samples[i].Time.After(at) })
+		if i > 0 && !samples[i-1].Time.Before(from) {
+			latest[id] = samples[i-1]
+		}
+	}
+	return latest, nil
+}
+
+func (m *Memory) Coordinates() (map[int]parken.Coordinates, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	coordinates := make(map[int]parken.Coordinates, len(m.coordinates))
+	for id, c := range m.coordinates {
+		coordinates[id] = c
+	}
+	return coordinates, nil
+}
+
+func (m *Memory) SaveCoordinates(id int, coordinates parken.Coordinates) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.coordinates[id]; ok {
+		return fmt.Errorf("coordinates of parking with ID %d exist already", id)
+	}
+	m.coordinates[id] = coordinates
+	return nil
+}
+
+func (m *Memory) Metadata(at time.Time) (map[int][]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	metadata := make(map[int][]byte)
+	for id, versions := range m.metadata {
+		i := len(versions)
+		if !at.IsZero() {
+			i = sort.Search(len(versions), func(i int) bool { return versions[i].time.After(at) })
+		}
+		if i > 0 {
+			metadata[id] = versions[i-1].data
+		}
+	}
+	return metadata, nil
+}
+
+func (m *Memory) SaveMetadata(id int, updated time.Time, data []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	updated = updated.UTC().Truncate(time.Second)
+	versions := m.metadata[id]
+	i := sort.Search(len(versions), func(i int) bool { return !versions[i].time.Before(updated) })
+	if i < len(versions) && versions[i].time.Equal(updated) {
+		return fmt.Errorf("metadata of parking with ID %d at %s exists already", id, updated)
+	}
+	versions = append(versions, metadataVersion{})
+	copy(versions[i+1:], versions[i:])
+	versions[i] = metadataVersion{updated, append([]byte(nil), data...)}
+	m.metadata[id] = versions
+	return nil
+}
+
+func (m *Memory) Overrides() (map[int]Override, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	overrides := make(map[int]Override, len(m.overrides))
+	for id, o := range m.overrides {
+		overrides[id] = o
+	}
+	return overrides, nil
+}
+
+// record records the audit entry. The caller must hold m.mutex.
+func (m *Memory) record(entry AuditEntry) {
+	entry.ID = int64(len(m.audit)) + 1
+	entry.Time = entry.Time.UTC().Truncate(time.Second)
+	m.audit = append(m.audit, entry)
+}
+
+func (m *Memory) SetOverride(id int, o Override, entry AuditEntry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	o.Updated = o.Updated.UTC().Truncate(time.Second)
+	m.overrides[id] = o
+	m.record(entry)
+	return nil
+}
+
+func (m *Memory) DeleteOverride(id int, entry AuditEntry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.overrides, id)
+	m.record(entry)
+	return nil
+}
+
+func (m *Memory) Audit(entry AuditEntry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.record(entry)
+	return nil
+}
+
+func (m *Memory) AuditEntries(parkingID, limit int) ([]AuditEntry, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	entries := []AuditEntry{}
+	for i := len(m.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if parkingID == 0 || m.audit[i].ParkingID == parkingID {
+			entries = append(entries, m.audit[i])
+		}
+	}
+	return entries, nil
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
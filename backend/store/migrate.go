@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the migrations of each dialect in a directory named
+// after it. A migration consists of the files <version>_<name>.up.sql and
+// <version>_<name>.down.sql, whose statements end with a semicolon at the end
+// of a line. A down file starting with the comment "-- destructive" drops data.
+//
+// MySQL commits each DDL statement implicitly, so a migration failing halfway
+// through stays partly applied and its version is not recorded. All statements
+// must therefore be idempotent: once the cause of the failure is fixed,
+// migrating again applies the remaining statements.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrDestructive is returned if reverting migrations would drop data without
+// being forced.
+var ErrDestructive = errors.New("reverting the migration drops data")
+
+// lockTimeout is how long an instance waits for another one to finish
+// migrating.
+const lockTimeout = time.Minute
+
+// Migrator is implemented by the stores whose schema is versioned.
+type Migrator interface {
+	// SchemaVersion returns the version of the schema and the latest version
+	// known to this binary. The version is 0 if no migration has been
+	// applied.
+	SchemaVersion(ctx context.Context) (current, latest int, err error)
+	// Migrate applies or reverts migrations until the schema has the given
+	// version. Unless force is set, reverting migrations that drop data fails
+	// with ErrDestructive before anything is reverted. Concurrent
+	// migrations of the same database, also by other processes, wait for
+	// each other. If a statement fails, the error names it and migrating
+	// again resumes once the cause is fixed.
+	Migrate(ctx context.Context, version int, force bool) error
+}
+
+type migration struct {
+	version int
+	name    string
+	up      []string
+	down    []string
+	// destructive reports whether down drops data.
+	destructive bool
+}
+
+// dialect describes the differences of the SQL databases concerning
+// migrations.
+type dialect struct {
+	name               string
+	createVersionTable string
+	// lock prevents other instances from migrating until unlock is called.
+	// If the dialect supports transactional DDL, the migrations are applied
+	// by unlock if commit is true and discarded otherwise.
+	lock func(ctx context.Context, conn *sql.Conn) (unlock func(commit bool) error, err error)
+}
+
+// statements splits the contents of a migration file.
+func statements(contents string) []string {
+	var statements []string
+	for _, statement := range strings.Split(contents, ";\n") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, strings.TrimSuffix(statement, ";")+";")
+		}
+	}
+	return statements
+}
+
+// loadMigrations returns the migrations of the dialect in ascending order of
+// version, which must be consecutive from 1 on.
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		prefix, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		contents, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = statements(string(contents))
+		} else {
+			m.down = statements(string(contents))
+			m.destructive = strings.HasPrefix(string(contents), "-- destructive")
+		}
+	}
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if m.up == nil || m.down == nil {
+			return nil, fmt.Errorf("migration %d lacks up or down statements", m.version)
+		}
+	}
+	return migrations, nil
+}
+
+// schemaVersion creates the table recording the applied migrations unless it
+// exists and returns the version of the schema.
+func (s *sqlStore) schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	if _, err := conn.ExecContext(ctx, s.dialect.createVersionTable); err != nil {
+		return 0, fmt.Errorf("creating schema_version table: %w", err)
+	}
+	var version int
+	err := conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version;").Scan(&version)
+	return version, err
+}
+
+func (s *sqlStore) SchemaVersion(ctx context.Context) (current, latest int, err error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	current, err = s.schemaVersion(ctx, conn)
+	return current, len(s.migrations), err
+}
+
+func (s *sqlStore) Migrate(ctx context.Context, version int, force bool) (err error) {
+	if version < 0 || version > len(s.migrations) {
+		return fmt.Errorf("unknown schema version %d, the latest one is %d", version, len(s.migrations))
+	}
+	// The lock and the migrations are bound to the same connection.
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	unlock, err := s.dialect.lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("locking schema: %w", err)
+	}
+	defer func() {
+		if unlockErr := unlock(err == nil); err == nil && unlockErr != nil {
+			err = fmt.Errorf("unlocking schema: %w", unlockErr)
+		}
+	}()
+	// The version is read while holding the lock, since another instance
+	// may just have migrated.
+	current, err := s.schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if current > len(s.migrations) {
+		return fmt.Errorf("schema version %d is newer than the latest one known, %d", current, len(s.migrations))
+	}
+	if !force {
+		for _, m := range s.migrations[min(version, current):current] {
+			if m.destructive {
+				return fmt.Errorf("reverting migration %d (%s): %w", m.version, m.name, ErrDestructive)
+			}
+		}
+	}
+	for ; current < version; current++ {
+		m := s.migrations[current]
+		if err := apply(ctx, conn, m.up); err != nil {
+			return fmt.Errorf("applying migration %d (%s): %w", m.version, m.name, err)
+		}
+		_, err := conn.ExecContext(ctx, "INSERT INTO schema_version (version, applied) VALUES (?, ?);",
+			m.version, formatTime(time.Now()))
+		if err != nil {
+			return err
+		}
+	}
+	for ; current > version; current-- {
+		m := s.migrations[current-1]
+		if err := apply(ctx, conn, m.down); err != nil {
+			return fmt.Errorf("reverting migration %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := conn.ExecContext(ctx, "DELETE FROM schema_version WHERE version = ?;", m.version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply executes the statements. If one fails, the error contains its number
+// and its first line that is not a comment.
+func apply(ctx context.Context, conn *sql.Conn, statements []string) error {
+	for i, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("statement %d, %q: %w", i+1, firstLine(statement), err)
+		}
+	}
+	return nil
+}
+
+func firstLine(statement string) string {
+	for _, line := range strings.Split(statement, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return line
+		}
+	}
+	return statement
+}
@@ -0,0 +1,12 @@
+-- Deployments predating migrations have the tables already.
+CREATE TABLE IF NOT EXISTS spots (
+parking_id INT NOT NULL,
+time DATETIME NOT NULL,
+free INT,
+PRIMARY KEY (parking_id, time));
+
+CREATE TABLE IF NOT EXISTS coordinates (
+parking_id INT NOT NULL,
+latitude DOUBLE NOT NULL,
+longitude DOUBLE NOT NULL,
+PRIMARY KEY (parking_id));
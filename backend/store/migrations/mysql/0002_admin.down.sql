@@ -0,0 +1,3 @@
+-- destructive: drops the overrides and the audit log.
+DROP TABLE IF EXISTS audit;
+DROP TABLE IF EXISTS overrides;
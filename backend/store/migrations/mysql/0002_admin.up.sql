@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS overrides (
+parking_id INT NOT NULL,
+latitude DOUBLE,
+longitude DOUBLE,
+name VARCHAR(255),
+phone_number VARCHAR(255),
+website VARCHAR(2048),
+notes TEXT,
+updated DATETIME NOT NULL,
+updated_by VARCHAR(255) NOT NULL,
+PRIMARY KEY (parking_id));
+
+CREATE TABLE IF NOT EXISTS audit (
+id BIGINT NOT NULL AUTO_INCREMENT,
+time DATETIME NOT NULL,
+actor VARCHAR(255) NOT NULL,
+action VARCHAR(64) NOT NULL,
+parking_id INT,
+details TEXT,
+PRIMARY KEY (id),
+INDEX (parking_id));
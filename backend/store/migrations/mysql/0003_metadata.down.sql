@@ -0,0 +1,2 @@
+-- destructive: drops the history of the metadata.
+DROP TABLE IF EXISTS metadata;
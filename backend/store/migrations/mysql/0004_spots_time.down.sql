@@ -0,0 +1,7 @@
+-- MySQL cannot drop an index only if it exists.
+SET @statement = IF((SELECT COUNT(*) FROM information_schema.statistics
+WHERE table_schema = DATABASE() AND table_name = 'spots' AND index_name = 'spots_time') > 0,
+'DROP INDEX spots_time ON spots', 'DO 0');
+PREPARE statement FROM @statement;
+EXECUTE statement;
+DEALLOCATE PREPARE statement;
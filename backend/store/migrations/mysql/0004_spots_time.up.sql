@@ -0,0 +1,9 @@
+-- Searching samples by time, e.g. to reconstruct snapshots, uses the index.
+-- Deployments predating migrations have it already, and MySQL cannot create an
+-- index only if it does not exist.
+SET @statement = IF((SELECT COUNT(*) FROM information_schema.statistics
+WHERE table_schema = DATABASE() AND table_name = 'spots' AND index_name = 'spots_time') = 0,
+'CREATE INDEX spots_time ON spots (time)', 'DO 0');
+PREPARE statement FROM @statement;
+EXECUTE statement;
+DEALLOCATE PREPARE statement;
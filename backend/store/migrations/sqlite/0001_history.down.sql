@@ -0,0 +1,3 @@
+-- destructive: drops the occupancy history and the coordinates.
+DROP TABLE IF EXISTS coordinates;
+DROP TABLE IF EXISTS spots;
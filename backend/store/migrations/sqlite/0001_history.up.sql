@@ -0,0 +1,12 @@
+-- Times are stored as text, which compares in chronological order.
+CREATE TABLE IF NOT EXISTS spots (
+parking_id INTEGER NOT NULL,
+time TEXT NOT NULL,
+free INTEGER,
+PRIMARY KEY (parking_id, time));
+
+CREATE TABLE IF NOT EXISTS coordinates (
+parking_id INTEGER NOT NULL,
+latitude REAL NOT NULL,
+longitude REAL NOT NULL,
+PRIMARY KEY (parking_id));
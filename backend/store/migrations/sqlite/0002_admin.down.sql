@@ -0,0 +1,4 @@
+-- destructive: drops the overrides and the audit log.
+DROP INDEX IF EXISTS audit_parking_id;
+DROP TABLE IF EXISTS audit;
+DROP TABLE IF EXISTS overrides;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS overrides (
+parking_id INTEGER NOT NULL,
+latitude REAL,
+longitude REAL,
+name TEXT,
+phone_number TEXT,
+website TEXT,
+notes TEXT,
+updated TEXT NOT NULL,
+updated_by TEXT NOT NULL,
+PRIMARY KEY (parking_id));
+
+CREATE TABLE IF NOT EXISTS audit (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+time TEXT NOT NULL,
+actor TEXT NOT NULL,
+action TEXT NOT NULL,
+parking_id INTEGER,
+details TEXT);
+
+CREATE INDEX IF NOT EXISTS audit_parking_id ON audit (parking_id);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS metadata (
+parking_id INTEGER NOT NULL,
+time TEXT NOT NULL,
+data TEXT,
+PRIMARY KEY (parking_id, time));
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS spots_time;
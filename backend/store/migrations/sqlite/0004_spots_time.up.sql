@@ -0,0 +1,3 @@
+-- Searching samples by time, e.g. to reconstruct snapshots, uses the index.
+-- Deployments predating migrations have it already.
+CREATE INDEX IF NOT EXISTS spots_time ON spots (time);
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDatabase is the database used if the data source name names none.
+const mysqlDatabase = "parken"
+
+var mysqlDialect = dialect{
+	name: "mysql",
+	createVersionTable: `CREATE TABLE IF NOT EXISTS schema_version (
+version INT NOT NULL,
+applied DATETIME NOT NULL,
+PRIMARY KEY (version));`,
+	// Named locks are held by the session and are global to the server, so
+	// the name includes the database.
+	lock: func(ctx context.Context, conn *sql.Conn) (func(commit bool) error, error) {
+		var acquired sql.NullInt64
+		err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(CONCAT('parken_migrations.', DATABASE()), ?);",
+			int(lockTimeout.Seconds())).Scan(&acquired)
+		if err != nil {
+			return nil, err
+		}
+		if acquired.Int64 != 1 {
+			return nil, errLockTimeout
+		}
+		// DDL statements are committed implicitly, so commit has no effect.
+		return func(commit bool) error {
+			_, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK(CONCAT('parken_migrations.', DATABASE()));")
+			return err
+		}, nil
+	},
+}
+
+// errLockTimeout is returned if another instance migrates for longer than
+// lockTimeout.
+var errLockTimeout = errors.New("timed out waiting for another instance to migrate")
+
+// OpenMySQL connects to a MySQL server and creates the database unless it
+// exists. If the data source name names no database, the database parken is
+// used. The tables are created by migrating the returned Store, which
+// implements Migrator.
+func OpenMySQL(dataSourceName string) (Store, error) {
+	config, err := mysql.ParseDSN(dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	if config.DBName == "" {
+		db, err := sql.Open("mysql", config.FormatDSN())
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.Exec("CREATE DATABASE IF NOT EXISTS " + mysqlDatabase + ";")
+		db.Close()
+		if err != nil {
+			return nil, fmt.Errorf("creating database: %w", err)
+		}
+		config.DBName = mysqlDatabase
+	}
+	db, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s, err := newSQLStore(db, &mysqlDialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// sqlStore implements Store with SQL understood by both MySQL and SQLite.
+type sqlStore struct {
+	db         *sql.DB
+	dialect    *dialect
+	migrations []migration
+}
+
+func newSQLStore(db *sql.DB, d *dialect) (*sqlStore, error) {
+	migrations, err := loadMigrations(d.name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStore{db, d, migrations}, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+func stringPointer(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func (s *sqlStore) SaveSpots(updated time.Time, parkings []parken.Parking) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("INSERT INTO spots (parking_id, time, free) VALUES (?, ?, ?);")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range parkings {
+		if _, err := stmt.Exec(p.ID, formatTime(updated), p.Spots); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) LatestUpdate() (time.Time, error) {
+	var updated string
+	err := s.db.QueryRow("SELECT time FROM spots ORDER BY time DESC LIMIT 1;").Scan(&updated)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(timeLayout, updated)
+}
+
+func (s *sqlStore) History(ids []int, from, to time.Time) ([]Sample, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]any, 0, len(ids)+2)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, formatTime(from), formatTime(to))
+	query := "SELECT time, SUM(free) FROM spots WHERE parking_id IN (?" + strings.Repeat(", ?", len(ids)-1) +
+		") AND time >= ? AND time < ? GROUP BY time ORDER BY time;"
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var samples []Sample
+	var t string
+	var free sql.NullInt64
+	for rows.Next() {
+		if err := rows.Scan(&t, &free); err != nil {
+			return nil, err
+		}
+		if !free.Valid {
+			continue
+		}
+		parsed, err := time.Parse(timeLayout, t)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, Sample{Time: parsed, Free: int(free.Int64)})
+	}
+	return samples, rows.Err()
+}
+
+func (s *sqlStore) SamplesAt(from, at time.Time) (map[int]Sample, error) {
+	rows, err := s.db.Query(`SELECT s.parking_id, s.time, s.free FROM spots s
+JOIN (SELECT parking_id, MAX(time) AS time FROM spots WHERE time >= ? AND time <= ? AND free IS NOT NULL GROUP BY parking_id) l
+ON s.parking_id = l.parking_id AND s.time = l.time;`, formatTime(from), formatTime(at))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	samples := make(map[int]Sample)
+	for rows.Next() {
+		var id, free int
+		var t string
+		if err := rows.Scan(&id, &t, &free); err != nil {
+			return nil, err
+		}
+		parsed, err := time.Parse(timeLayout, t)
+		if err != nil {
+			return nil, err
+		}
+		samples[id] = Sample{Time: parsed, Free: free}
+	}
+	return samples, rows.Err()
+}
+
+func (s *sqlStore) Coordinates() (map[int]parken.Coordinates, error) {
+	rows, err := s.db.Query("SELECT parking_id, latitude, longitude FROM coordinates;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	coordinates := make(map[int]parken.Coordinates)
+	var id int
+	var current parken.Coordinates
+	for rows.Next() {
+		if err := rows.Scan(&id, &current.Latitude, &current.Longitude); err != nil {
+			return nil, err
+		}
+		coordinates[id] = current
+	}
+	return coordinates, rows.Err()
+}
+
+func (s *sqlStore) SaveCoordinates(id int, coordinates parken.Coordinates) error {
+	_, err := s.db.Exec("INSERT INTO coordinates (parking_id, latitude, longitude) VALUES (?, ?, ?);",
+		id, coordinates.Latitude, coordinates.Longitude)
+	return err
+}
+
+func (s *sqlStore) Metadata(at time.Time) (map[int][]byte, error) {
+	var args []any
+	latest := "SELECT parking_id, MAX(time) AS time FROM metadata"
+	if !at.IsZero() {
+		latest += " WHERE time <= ?"
+		args = append(args, formatTime(at))
+	}
+	rows, err := s.db.Query(`SELECT m.parking_id, m.data FROM metadata m
+JOIN (`+latest+` GROUP BY parking_id) l ON m.parking_id = l.parking_id AND m.time = l.time;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	metadata := make(map[int][]byte)
+	for rows.Next() {
+		var id int
+		var data sql.NullString
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		metadata[id] = nil
+		if data.Valid {
+			metadata[id] = []byte(data.String)
+		}
+	}
+	return metadata, rows.Err()
+}
+
+func (s *sqlStore) SaveMetadata(id int, updated time.Time, data []byte) error {
+	var value sql.NullString
+	if data != nil {
+		value = sql.NullString{String: string(data), Valid: true}
+	}
+	_, err := s.db.Exec("INSERT INTO metadata (parking_id, time, data) VALUES (?, ?, ?);", id, formatTime(updated), value)
+	return err
+}
+
+func (s *sqlStore) Overrides() (map[int]Override, error) {
+	rows, err := s.db.Query("SELECT parking_id, latitude, longitude, name, phone_number, website, notes, updated, updated_by FROM overrides;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	overrides := make(map[int]Override)
+	for rows.Next() {
+		var id int
+		var o Override
+		var latitude, longitude sql.NullFloat64
+		var name, phoneNumber, website, notes sql.NullString
+		var updated string
+		if err := rows.Scan(&id, &latitude, &longitude, &name, &phoneNumber, &website, &notes, &updated, &o.UpdatedBy); err != nil {
+			return nil, err
+		}
+		if latitude.Valid && longitude.Valid {
+			o.Coordinates = &parken.Coordinates{Latitude: latitude.Float64, Longitude: longitude.Float64}
+		}
+		o.Name, o.PhoneNumber, o.Website, o.Notes = stringPointer(name), stringPointer(phoneNumber), stringPointer(website), stringPointer(notes)
+		if o.Updated, err = time.Parse(timeLayout, updated); err != nil {
+			return nil, err
+		}
+		overrides[id] = o
+	}
+	return overrides, rows.Err()
+}
+
+// audited runs the change and records the audit entry in a transaction.
+func (s *sqlStore) audited(entry AuditEntry, change func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if change != nil {
+		if err := change(tx); err != nil {
+			return err
+		}
+	}
+	var details sql.NullString
+	if entry.Details != nil {
+		details = sql.NullString{String: string(entry.Details), Valid: true}
+	}
+	_, err = tx.Exec("INSERT INTO audit (time, actor, action, parking_id, details) VALUES (?, ?, ?, ?, ?);",
+		formatTime(entry.Time), entry.Actor, entry.Action,
+		sql.NullInt64{Int64: int64(entry.ParkingID), Valid: entry.ParkingID != 0}, details)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SetOverride(id int, o Override, entry AuditEntry) error {
+	return s.audited(entry, func(tx *sql.Tx) error {
+		var latitude, longitude sql.NullFloat64
+		if o.Coordinates != nil {
+			latitude = sql.NullFloat64{Float64: o.Coordinates.Latitude, Valid: true}
+			longitude = sql.NullFloat64{Float64: o.Coordinates.Longitude, Valid: true}
+		}
+		_, err := tx.Exec(`REPLACE INTO overrides (parking_id, latitude, longitude, name, phone_number, website, notes, updated, updated_by)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`, id, latitude, longitude, nullString(o.Name), nullString(o.PhoneNumber),
+			nullString(o.Website), nullString(o.Notes), formatTime(o.Updated), o.UpdatedBy)
+		return err
+	})
+}
+
+func (s *sqlStore) DeleteOverride(id int, entry AuditEntry) error {
+	return s.audited(entry, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM overrides WHERE parking_id = ?;", id)
+		return err
+	})
+}
+
+func (s *sqlStore) Audit(entry AuditEntry) error {
+	return s.audited(entry, nil)
+}
+
+func (s *sqlStore) AuditEntries(parkingID, limit int) ([]AuditEntry, error) {
+	query := "SELECT id, time, actor, action, parking_id, details FROM audit"
+	var args []any
+	if parkingID != 0 {
+		query += " WHERE parking_id = ?"
+		args = append(args, parkingID)
+	}
+	query += " ORDER BY id DESC LIMIT ?;"
+	args = append(args, limit)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var t string
+		var id sql.NullInt64
+		var details sql.NullString
+		if err := rows.Scan(&entry.ID, &t, &entry.Actor, &entry.Action, &id, &details); err != nil {
+			return nil, err
+		}
+		if entry.Time, err = time.Parse(timeLayout, t); err != nil {
+			return nil, err
+		}
+		entry.ParkingID = int(id.Int64)
+		if details.Valid {
+			entry.Details = json.RawMessage(details.String)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
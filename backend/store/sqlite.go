@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+var sqliteDialect = dialect{
+	name: "sqlite",
+	createVersionTable: `CREATE TABLE IF NOT EXISTS schema_version (
+version INTEGER NOT NULL,
+applied TEXT NOT NULL,
+PRIMARY KEY (version));`,
+	// The migrations run in a transaction holding the write lock of the
+	// database, for which other processes wait up to the busy timeout.
+	lock: func(ctx context.Context, conn *sql.Conn) (func(commit bool) error, error) {
+		if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE;"); err != nil {
+			return nil, err
+		}
+		return func(commit bool) error {
+			end := "ROLLBACK;"
+			if commit {
+				end = "COMMIT;"
+			}
+			_, err := conn.ExecContext(context.Background(), end)
+			return err
+		}, nil
+	},
+}
+
+// OpenSQLite opens the SQLite database in the given file. The tables are
+// created by migrating the returned Store, which implements Migrator.
+func OpenSQLite(path string) (Store, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	// Other processes accessing the database, e.g. migrating it, are waited
+	// for instead of failing with busy errors.
+	db, err := sql.Open("sqlite", fmt.Sprintf("%s%s_pragma=busy_timeout(%d)", path, separator, lockTimeout.Milliseconds()))
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, which is enforced by using a single
+	// connection instead of failing with busy errors.
+	db.SetMaxOpenConns(1)
+	s, err := newSQLStore(db, &sqliteDialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
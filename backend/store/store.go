@@ -0,0 +1,85 @@
+// Package store persists the occupancy history of the parkings and the data
+// maintained alongside it, either in MySQL, in SQLite or in memory.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+// Sample is the number of free spots at a time.
+type Sample struct {
+	Time time.Time
+	Free int
+}
+
+// Override replaces the coordinates and metadata of a parking. Fields that are
+// nil are taken from upstream.
+type Override struct {
+	Coordinates *parken.Coordinates
+	Name        *string
+	PhoneNumber *string
+	Website     *string
+	Notes       *string
+	Updated     time.Time
+	UpdatedBy   string
+}
+
+// AuditEntry describes a change made by an administrator. ParkingID is 0 if
+// the change does not concern a parking.
+type AuditEntry struct {
+	ID        int64
+	Time      time.Time
+	Actor     string
+	Action    string
+	ParkingID int
+	Details   json.RawMessage
+}
+
+// Store is implemented by the backends. Times are stored with a precision of
+// seconds.
+type Store interface {
+	// SaveSpots records the free spots of the parkings at the time of an
+	// update.
+	SaveSpots(updated time.Time, parkings []parken.Parking) error
+	// LatestUpdate returns the time of the latest recorded spots, which is
+	// zero if there are none.
+	LatestUpdate() (time.Time, error)
+	// History returns the free spots of the given parkings between from
+	// inclusive and to exclusive in chronological order. The spots of
+	// several parkings are summed up per time.
+	History(ids []int, from, to time.Time) ([]Sample, error)
+	// SamplesAt returns the latest sample of each parking between from and at
+	// inclusive. Parkings without a sample in that range are left out, so
+	// that from bounds the part of the history that is searched.
+	SamplesAt(from, at time.Time) (map[int]Sample, error)
+
+	// Coordinates returns the coordinates found by geocoding.
+	Coordinates() (map[int]parken.Coordinates, error)
+	SaveCoordinates(id int, coordinates parken.Coordinates) error
+
+	// Metadata returns the metadata of each parking valid at the given time,
+	// or the latest one if the time is zero. Removed parkings have nil
+	// metadata.
+	Metadata(at time.Time) (map[int][]byte, error)
+	// SaveMetadata records the metadata of a parking from the time of an
+	// update on. It is nil if the parking has been removed.
+	SaveMetadata(id int, updated time.Time, data []byte) error
+
+	Overrides() (map[int]Override, error)
+	// SetOverride and DeleteOverride change the override of a parking and
+	// record the audit entry of the change atomically.
+	SetOverride(id int, o Override, entry AuditEntry) error
+	DeleteOverride(id int, entry AuditEntry) error
+	// Audit records an audit entry.
+	Audit(entry AuditEntry) error
+	// AuditEntries returns the latest audit entries, optionally restricted
+	// to a parking, from the latest one on.
+	AuditEntries(parkingID, limit int) ([]AuditEntry, error)
+
+	Ping(ctx context.Context) error
+	Close() error
+}
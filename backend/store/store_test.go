@@ -0,0 +1,432 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+var (
+	t1 = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	t2 = t1.Add(5 * time.Minute)
+)
+
+// openSQLite opens a migrated SQLite database in a temporary directory.
+func openSQLite(t *testing.T) *sqlStore {
+	t.Helper()
+	st, err := OpenSQLite(filepath.Join(t.TempDir(), "parken.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	s := st.(*sqlStore)
+	if err := s.Migrate(context.Background(), len(s.migrations), false); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// forEachStore runs the test against each backend that needs no server.
+func forEachStore(t *testing.T, test func(t *testing.T, st Store)) {
+	t.Run("memory", func(t *testing.T) { test(t, NewMemory()) })
+	t.Run("sqlite", func(t *testing.T) { test(t, openSQLite(t)) })
+}
+
+func parkings(spots map[int]int) []parken.Parking {
+	var parkings []parken.Parking
+	for id, free := range spots {
+		parkings = append(parkings, parken.Parking{ID: id, Spots: free})
+	}
+	return parkings
+}
+
+func equalSamples(a, b []Sample) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Time.Equal(b[i].Time) || a[i].Free != b[i].Free {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpots(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		if latest, err := st.LatestUpdate(); err != nil || !latest.IsZero() {
+			t.Fatalf("LatestUpdate of empty store = %v, %v", latest, err)
+		}
+		if err := st.SaveSpots(t1, parkings(map[int]int{1: 10, 2: 5, 3: 7})); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.SaveSpots(t2, parkings(map[int]int{1: 8, 2: 4})); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.SaveSpots(t2, parkings(map[int]int{1: 8})); err == nil {
+			t.Error("saving spots of the same time twice succeeded")
+		}
+		if latest, err := st.LatestUpdate(); err != nil || !latest.Equal(t2) {
+			t.Errorf("LatestUpdate = %v, %v, want %v", latest, err, t2)
+		}
+
+		for _, test := range []struct {
+			ids      []int
+			from, to time.Time
+			want     []Sample
+		}{
+			{[]int{1, 2}, t1, t2.Add(time.Second), []Sample{{t1, 15}, {t2, 12}}},
+			{[]int{1}, t1, t2, []Sample{{t1, 10}}},
+			{[]int{3}, t1.Add(time.Second), t2.Add(time.Second), nil},
+			{nil, t1, t2, nil},
+		} {
+			samples, err := st.History(test.ids, test.from, test.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalSamples(samples, test.want) {
+				t.Errorf("History(%v, %v, %v) = %v, want %v", test.ids, test.from, test.to, samples, test.want)
+			}
+		}
+	})
+}
+
+func TestSamplesAt(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		if err := st.SaveSpots(t1, parkings(map[int]int{1: 10, 2: 5})); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.SaveSpots(t2, parkings(map[int]int{1: 8})); err != nil {
+			t.Fatal(err)
+		}
+		for _, test := range []struct {
+			from, at time.Time
+			want     map[int]Sample
+		}{
+			{t1.Add(-time.Hour), t1.Add(time.Minute), map[int]Sample{1: {t1, 10}, 2: {t1, 5}}},
+			{t1.Add(-time.Hour), t2, map[int]Sample{1: {t2, 8}, 2: {t1, 5}}},
+			{t1.Add(time.Second), t2, map[int]Sample{1: {t2, 8}}},
+			{t1.Add(time.Second), t2.Add(-time.Second), map[int]Sample{}},
+			{t1.Add(-time.Hour), t1.Add(-time.Second), map[int]Sample{}},
+		} {
+			samples, err := st.SamplesAt(test.from, test.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(samples) != len(test.want) {
+				t.Errorf("SamplesAt(%v, %v) = %v, want %v", test.from, test.at, samples, test.want)
+				continue
+			}
+			for id, want := range test.want {
+				if got, ok := samples[id]; !ok || !got.Time.Equal(want.Time) || got.Free != want.Free {
+					t.Errorf("SamplesAt(%v, %v)[%d] = %v, want %v", test.from, test.at, id, got, want)
+				}
+			}
+		}
+	})
+}
+
+func TestCoordinates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		c := parken.Coordinates{Latitude: 49.41, Longitude: 8.69}
+		if err := st.SaveCoordinates(1, c); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.SaveCoordinates(1, c); err == nil {
+			t.Error("saving coordinates twice succeeded")
+		}
+		coordinates, err := st.Coordinates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(coordinates) != 1 || coordinates[1] != c {
+			t.Errorf("Coordinates = %v, want %v", coordinates, map[int]parken.Coordinates{1: c})
+		}
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		for _, version := range []struct {
+			id   int
+			time time.Time
+			data []byte
+		}{
+			{1, t1, []byte(`{"name":"a"}`)},
+			{1, t2, []byte(`{"name":"b"}`)},
+			{2, t1, []byte(`{"name":"c"}`)},
+			{2, t2, nil},
+		} {
+			if err := st.SaveMetadata(version.id, version.time, version.data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, test := range []struct {
+			at   time.Time
+			want map[int]string
+		}{
+			{time.Time{}, map[int]string{1: `{"name":"b"}`, 2: ""}},
+			{t1, map[int]string{1: `{"name":"a"}`, 2: `{"name":"c"}`}},
+			{t2.Add(-time.Second), map[int]string{1: `{"name":"a"}`, 2: `{"name":"c"}`}},
+			{t1.Add(-time.Second), map[int]string{}},
+		} {
+			metadata, err := st.Metadata(test.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(metadata) != len(test.want) {
+				t.Errorf("Metadata(%v) = %q, want %q", test.at, metadata, test.want)
+				continue
+			}
+			for id, want := range test.want {
+				data, ok := metadata[id]
+				if !ok || string(data) != want || (want == "") != (data == nil) {
+					t.Errorf("Metadata(%v)[%d] = %q, want %q", test.at, id, data, want)
+				}
+			}
+		}
+	})
+}
+
+func TestOverrides(t *testing.T) {
+	forEachStore(t, func(t *testing.T, st Store) {
+		name, notes := "Kornmarkt", "Baustelle"
+		o := Override{Coordinates: &parken.Coordinates{Latitude: 49.41, Longitude: 8.69}, Name: &name, Notes: &notes,
+			Updated: t1, UpdatedBy: "ops"}
+		details := json.RawMessage(`{"name":"Kornmarkt"}`)
+		if err := st.SetOverride(1, o, AuditEntry{Time: t1, Actor: "ops", Action: "set_override", ParkingID: 1, Details: details}); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Audit(AuditEntry{Time: t1, Actor: "ops", Action: "reload"}); err != nil {
+			t.Fatal(err)
+		}
+		overrides, err := st.Overrides()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := overrides[1]
+		if !ok || *got.Coordinates != *o.Coordinates || *got.Name != name || *got.Notes != notes ||
+			got.PhoneNumber != nil || got.Website != nil || !got.Updated.Equal(t1) || got.UpdatedBy != "ops" {
+			t.Errorf("Overrides()[1] = %+v, want %+v", got, o)
+		}
+
+		if err := st.DeleteOverride(1, AuditEntry{Time: t2, Actor: "ops", Action: "delete_override", ParkingID: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if overrides, err := st.Overrides(); err != nil || len(overrides) != 0 {
+			t.Errorf("Overrides after deletion = %v, %v", overrides, err)
+		}
+
+		entries, err := st.AuditEntries(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actions []string
+		for _, entry := range entries {
+			actions = append(actions, entry.Action)
+		}
+		if len(entries) != 3 || actions[0] != "delete_override" || actions[1] != "reload" || actions[2] != "set_override" {
+			t.Fatalf("actions of AuditEntries = %v", actions)
+		}
+		if set := entries[2]; !set.Time.Equal(t1) || set.Actor != "ops" || set.ParkingID != 1 || string(set.Details) != string(details) {
+			t.Errorf("audit entry = %+v", set)
+		}
+		if entries, err := st.AuditEntries(1, 1); err != nil || len(entries) != 1 || entries[0].Action != "delete_override" {
+			t.Errorf("AuditEntries(1, 1) = %+v, %v", entries, err)
+		}
+	})
+}
+
+// TestAuditedAtomicity checks that an override is not changed if its audit
+// entry cannot be recorded.
+func TestAuditedAtomicity(t *testing.T) {
+	s := openSQLite(t)
+	name := "Kornmarkt"
+	if err := s.SetOverride(1, Override{Name: &name, Updated: t1, UpdatedBy: "ops"}, AuditEntry{Time: t1, Actor: "ops", Action: "set_override"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec("DROP TABLE audit;"); err != nil {
+		t.Fatal(err)
+	}
+	other := "Bahnhof"
+	if err := s.SetOverride(1, Override{Name: &other, Updated: t2, UpdatedBy: "ops"}, AuditEntry{Time: t2, Actor: "ops", Action: "set_override"}); err == nil {
+		t.Fatal("setting an override without audit table succeeded")
+	}
+	if err := s.DeleteOverride(1, AuditEntry{Time: t2, Actor: "ops", Action: "delete_override"}); err == nil {
+		t.Fatal("deleting an override without audit table succeeded")
+	}
+	overrides, err := s.Overrides()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := overrides[1]; !ok || *o.Name != name {
+		t.Errorf("override after failed changes = %+v", o)
+	}
+}
+
+func tables(t *testing.T, s *sqlStore) map[string]bool {
+	t.Helper()
+	rows, err := s.db.Query("SELECT name FROM sqlite_master WHERE type = 'table';")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables[name] = true
+	}
+	return tables
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	s := openSQLite(t)
+	current, latest, err := s.SchemaVersion(ctx)
+	if err != nil || current != latest || latest != len(s.migrations) {
+		t.Fatalf("SchemaVersion = %d, %d, %v", current, latest, err)
+	}
+	if err := s.Migrate(ctx, latest+1, false); err == nil {
+		t.Error("migrating to an unknown version succeeded")
+	}
+	if err := s.Migrate(ctx, 0, false); !errors.Is(err, ErrDestructive) {
+		t.Fatalf("reverting all migrations without force = %v, want ErrDestructive", err)
+	}
+	if current, _, _ := s.SchemaVersion(ctx); current != latest {
+		t.Errorf("version after refused reversion = %d, want %d", current, latest)
+	}
+
+	// The round trip is repeated to check that the down migrations leave
+	// nothing behind that the up migrations create.
+	for i := 0; i < 2; i++ {
+		if err := s.Migrate(ctx, 0, true); err != nil {
+			t.Fatal(err)
+		}
+		if current, _, _ := s.SchemaVersion(ctx); current != 0 {
+			t.Errorf("version after reverting = %d, want 0", current)
+		}
+		for _, table := range []string{"spots", "coordinates", "overrides", "audit", "metadata"} {
+			if tables(t, s)[table] {
+				t.Errorf("table %s exists after reverting all migrations", table)
+			}
+		}
+		if err := s.Migrate(ctx, latest, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SaveSpots(t1.Add(time.Duration(i)*time.Hour), parkings(map[int]int{1: 10})); err != nil {
+			t.Errorf("saving spots after migrating: %v", err)
+		}
+	}
+}
+
+// TestMigrateExisting checks that a database created before migrations
+// existed is adopted without losing its data.
+func TestMigrateExisting(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenSQLite(filepath.Join(t.TempDir(), "parken.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	s := st.(*sqlStore)
+	for _, statement := range s.migrations[0].up {
+		if _, err := s.db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SaveSpots(t1, parkings(map[int]int{1: 10})); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Migrate(ctx, len(s.migrations), false); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := s.History([]int{1}, t1, t2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalSamples(samples, []Sample{{t1, 10}}) {
+		t.Errorf("History after migrating = %v", samples)
+	}
+}
+
+// TestMigrateFailure checks that a failing statement is named and that the
+// migration can be retried once it is fixed.
+func TestMigrateFailure(t *testing.T) {
+	ctx := context.Background()
+	st, err := OpenSQLite(filepath.Join(t.TempDir(), "parken.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	s := st.(*sqlStore)
+	s.migrations = []migration{
+		{version: 1, name: "first", up: []string{"CREATE TABLE IF NOT EXISTS first (x INT);"}, down: []string{"DROP TABLE IF EXISTS first;"}},
+		{version: 2, name: "second", up: []string{"CREATE TABLE IF NOT EXISTS second (x INT);",
+			"-- The statement is misspelled.\nCREAT TABLE third (x INT);"}, down: []string{"DROP TABLE IF EXISTS second;"}},
+	}
+	err = s.Migrate(ctx, 2, false)
+	if err == nil || !strings.Contains(err.Error(), `migration 2 (second): statement 2, "CREAT TABLE third (x INT);"`) {
+		t.Fatalf("Migrate = %v, want an error naming the second statement of migration 2", err)
+	}
+	// SQLite discards all migrations of the failed run.
+	if current, _, _ := s.SchemaVersion(ctx); current != 0 {
+		t.Errorf("version after failing = %d, want 0", current)
+	}
+	s.migrations[1].up[1] = "CREATE TABLE IF NOT EXISTS third (x INT);"
+	if err := s.Migrate(ctx, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if current, _, _ := s.SchemaVersion(ctx); current != 2 {
+		t.Errorf("version after retrying = %d, want 2", current)
+	}
+}
+
+// TestMigrationsIdempotent checks that the statements of the migrations can be
+// executed again, as they are after a migration failed halfway on MySQL.
+func TestMigrationsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	s := openSQLite(t)
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, m := range s.migrations {
+		if err := apply(ctx, conn, m.up); err != nil {
+			t.Errorf("applying migration %d again: %v", m.version, err)
+		}
+	}
+	for i := len(s.migrations) - 1; i >= 0; i-- {
+		m := s.migrations[i]
+		for j := 0; j < 2; j++ {
+			if err := apply(ctx, conn, m.down); err != nil {
+				t.Errorf("reverting migration %d: %v", m.version, err)
+			}
+		}
+	}
+}
+
+// TestLoadMigrations checks that the migrations of all dialects are complete
+// and equal in number.
+func TestLoadMigrations(t *testing.T) {
+	n := -1
+	for _, d := range []*dialect{&mysqlDialect, &sqliteDialect} {
+		migrations, err := loadMigrations(d.name)
+		if err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+		if n >= 0 && len(migrations) != n {
+			t.Errorf("%s has %d migrations, want %d", d.name, len(migrations), n)
+		}
+		n = len(migrations)
+	}
+}
@@ -0,0 +1,216 @@
+package web
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken/store"
+)
+
+const (
+	// maxSignatureAge is the maximum difference between the time of a signed
+	// request and the time it is received.
+	maxSignatureAge     = 5 * time.Minute
+	maxAdminBody        = 1 << 20
+	defaultAuditEntries = 100
+	maxAuditEntries     = 1000
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// authenticateAdmin returns the name of the admin key the request is
+// authenticated with. Requests either carry the secret of the key as a bearer
+// token or are signed with it:
+//
+//	Authorization: HMAC-SHA256 <name>:<unix time>:<signature>
+//
+// The signature is the hex-encoded HMAC-SHA256 of the unix time, the method,
+// the request URI and the body, separated by newlines.
+func (s *Server) authenticateAdmin(r *http.Request) (string, error) {
+	authorization := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+		for name, secret := range s.AdminKeys {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1 {
+				return name, nil
+			}
+		}
+		return "", errUnauthorized
+	}
+	credentials, ok := strings.CutPrefix(authorization, "HMAC-SHA256 ")
+	if !ok {
+		return "", errUnauthorized
+	}
+	fields := strings.Split(credentials, ":")
+	if len(fields) != 3 {
+		return "", errUnauthorized
+	}
+	name, timestamp := fields[0], fields[1]
+	signature, err := hex.DecodeString(fields[2])
+	if err != nil {
+		return "", errUnauthorized
+	}
+	secret, ok := s.AdminKeys[name]
+	if !ok {
+		return "", errUnauthorized
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", errUnauthorized
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return "", errUnauthorized
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxAdminBody))
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n"))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return "", errUnauthorized
+	}
+	return name, nil
+}
+
+type adminHandlerFunc func(w http.ResponseWriter, r *http.Request, actor string)
+
+// admin wraps a handler of the admin API, which is disabled if the server has
+// no admin keys.
+func (s *Server) admin(handler adminHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.AdminKeys) == 0 {
+			httpError(w, http.StatusNotFound)
+			return
+		}
+		actor, err := s.authenticateAdmin(r)
+		if err != nil {
+			s.log().Warn("admin authentication failed", "path", r.URL.Path, "client", s.clientIP(r), "error", err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httpError(w, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		handler(w, r, actor)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	httpError(w, http.StatusMethodNotAllowed)
+}
+
+type auditEntry struct {
+	ID        int64           `json:"id"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	ParkingID int             `json:"parkingId,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+}
+
+// record applies a change made through the admin API to the store, which
+// audits it atomically. Without a store, the entry is only logged.
+func (s *Server) record(entry auditEntry, change func(st store.Store, entry store.AuditEntry) error) error {
+	entry.Time = time.Now().UTC()
+	s.dbMutex.Lock()
+	defer s.dbMutex.Unlock()
+	if st := s.Store(); st != nil {
+		if change == nil {
+			change = store.Store.Audit
+		}
+		if err := change(st, store.AuditEntry(entry)); err != nil {
+			return err
+		}
+	}
+	s.log().Info("audit", "actor", entry.Actor, "action", entry.Action, "parking_id", entry.ParkingID,
+		"details", string(entry.Details))
+	return nil
+}
+
+// queryAudit returns the latest audit entries, optionally restricted to a
+// parking.
+func (s *Server) queryAudit(parkingID, limit int) ([]auditEntry, error) {
+	s.dbMutex.Lock()
+	defer s.dbMutex.Unlock()
+	if s.Store() == nil {
+		return nil, errNoDB
+	}
+	stored, err := s.Store().AuditEntries(parkingID, limit)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]auditEntry, len(stored))
+	for i, entry := range stored {
+		entries[i] = auditEntry(entry)
+	}
+	return entries, nil
+}
+
+// auditHandler lists the latest audit entries. The parameter limit sets their
+// number and parkingId restricts them to a parking.
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request, actor string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	q := r.URL.Query()
+	limit, parkingID := defaultAuditEntries, 0
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxAuditEntries {
+			httpError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("parkingId"); v != "" {
+		if parkingID, err = strconv.Atoi(v); err != nil {
+			httpError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	entries, err := s.queryAudit(parkingID, limit)
+	if err != nil {
+		if err == errNoDB {
+			httpError(w, http.StatusServiceUnavailable)
+			return
+		}
+		s.log().Error("querying audit entries", "error", err)
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, entries)
+}
+
+// reloadHandler reloads the configuration through s.Reload.
+func (s *Server) reloadHandler(w http.ResponseWriter, r *http.Request, actor string) {
+	if s.Reload == nil {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if err := s.Reload(); err != nil {
+		s.log().Warn("reloading configuration failed", "actor", actor, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.record(auditEntry{Actor: actor, Action: "reload"}, nil); err != nil {
+		s.log().Error("auditing reload", "error", err)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("reloaded\n"))
+}
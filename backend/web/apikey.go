@@ -0,0 +1,116 @@
+package web
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// APIKey describes the consumer of an API key.
+type APIKey struct {
+	Consumer string
+	// DailyQuota limits the number of requests per day, which begins at
+	// midnight local time. The requests are unlimited if it is 0.
+	DailyQuota int
+}
+
+// apiKey returns the API key sent in the X-API-Key header. It reports false if
+// the key is unknown.
+func (s *Server) apiKey(r *http.Request) (APIKey, bool) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return APIKey{}, true
+	}
+	apiKey, ok := s.APIKeys[key]
+	return apiKey, ok
+}
+
+type consumerUsage struct {
+	// Today counts the requests since midnight and Total the ones since the
+	// start of the server.
+	Today    int              `json:"today"`
+	Total    int64            `json:"total"`
+	Routes   map[string]int64 `json:"routes"`
+	LastUsed time.Time        `json:"lastUsed"`
+}
+
+// usage counts the requests of the consumers of the API keys per route.
+type usage struct {
+	mutex     sync.Mutex
+	day       time.Time
+	consumers map[string]*consumerUsage
+}
+
+func newUsage() *usage {
+	return &usage{consumers: make(map[string]*consumerUsage)}
+}
+
+// count counts a request of the consumer unless it exceeds the daily quota, in
+// which case it returns the time until the quota is reset.
+func (u *usage) count(key APIKey, route string, now time.Time) (bool, time.Duration) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	day := resolutions["day"](now)
+	if !day.Equal(u.day) {
+		for _, c := range u.consumers {
+			c.Today = 0
+		}
+		u.day = day
+	}
+	c, ok := u.consumers[key.Consumer]
+	if !ok {
+		c = &consumerUsage{Routes: make(map[string]int64)}
+		u.consumers[key.Consumer] = c
+	}
+	if key.DailyQuota > 0 && c.Today >= key.DailyQuota {
+		next := day.In(location).AddDate(0, 0, 1)
+		return false, next.Sub(now)
+	}
+	c.Today++
+	c.Total++
+	c.Routes[route]++
+	c.LastUsed = now.UTC()
+	return true, 0
+}
+
+// get returns a copy of the usage of the consumer.
+func (u *usage) get(consumer string) consumerUsage {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	c, ok := u.consumers[consumer]
+	if !ok {
+		return consumerUsage{Routes: map[string]int64{}}
+	}
+	copied := *c
+	copied.Routes = make(map[string]int64, len(c.Routes))
+	for route, n := range c.Routes {
+		copied.Routes[route] = n
+	}
+	if !u.day.Equal(resolutions["day"](time.Now())) {
+		copied.Today = 0
+	}
+	return copied
+}
+
+type usageResponse struct {
+	Consumer   string `json:"consumer"`
+	DailyQuota int    `json:"dailyQuota"`
+	consumerUsage
+}
+
+// usageHandler reports the usage of the API per consumer and route.
+func (s *Server) usageHandler(w http.ResponseWriter, r *http.Request, actor string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	res := make([]usageResponse, 0, len(s.APIKeys))
+	for _, key := range s.APIKeys {
+		res = append(res, usageResponse{key.Consumer, key.DailyQuota, s.usage.get(key.Consumer)})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Consumer < res[j].Consumer
+	})
+	s.writeJSON(w, res)
+}
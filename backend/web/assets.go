@@ -0,0 +1,207 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// immutable is the Cache-Control value for fingerprinted assets, whose content
+// never changes.
+const immutable = "public, max-age=31536000, immutable"
+
+// staticReference matches references to assets in index.html.
+var staticReference = regexp.MustCompile(`((?:src|href)=")static/([^"]+)(")`)
+
+type asset struct {
+	name string
+	body *cachedBody
+	// fingerprinted is the name including a hash of the content, for example
+	// parken.0123abcd.js.
+	fingerprinted string
+	modTime       time.Time
+}
+
+// assets serves the frontend. The compressed variants of all files are
+// generated when the assets are created. As files served from disk may change,
+// a file is reloaded when its modification time changes.
+type assets struct {
+	fsys fs.FS
+
+	mutex         sync.RWMutex
+	byName        map[string]*asset
+	byFingerprint map[string]*asset
+	// index is index.html with references to fingerprinted assets. It is
+	// rebuilt if stale is set.
+	index *cachedBody
+	stale bool
+	// references are the names of the assets referenced by index.
+	references []string
+}
+
+func fingerprint(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+}
+
+func newAssets(fsys fs.FS) (*assets, error) {
+	a := &assets{fsys: fsys, byName: make(map[string]*asset), byFingerprint: make(map[string]*asset), stale: true}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(name, ".go") {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return a.load(name, info.ModTime())
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.indexBody(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// load reads and compresses a file. The caller must hold a.mutex unless the
+// assets are being created.
+func (a *assets) load(name string, modTime time.Time) error {
+	data, err := fs.ReadFile(a.fsys, name)
+	if err != nil {
+		return err
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	body, err := newCachedBody(contentType, data, time.Time{})
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", name, err)
+	}
+	if old, ok := a.byName[name]; ok {
+		delete(a.byFingerprint, old.fingerprinted)
+	}
+	as := &asset{name: name, body: body, fingerprinted: fingerprint(name, data), modTime: modTime}
+	a.byName[name], a.byFingerprint[as.fingerprinted] = as, as
+	a.stale = true
+	return nil
+}
+
+// lookup returns the asset with the given name or fingerprinted name. The
+// second result reports whether the name is fingerprinted. If the file has
+// changed, it is reloaded, so that the fingerprinted name of its previous
+// content no longer exists.
+func (a *assets) lookup(name string) (*asset, bool, error) {
+	a.mutex.RLock()
+	as, ok := a.byName[name]
+	fingerprinted := false
+	if !ok {
+		as, fingerprinted = a.byFingerprint[name]
+	}
+	a.mutex.RUnlock()
+	if as == nil {
+		return nil, false, fs.ErrNotExist
+	}
+
+	info, err := fs.Stat(a.fsys, as.name)
+	if err != nil {
+		return nil, false, err
+	}
+	if info.ModTime().Equal(as.modTime) {
+		return as, fingerprinted, nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err := a.load(as.name, info.ModTime()); err != nil {
+		return nil, false, err
+	}
+	as = a.byName[as.name]
+	if fingerprinted && as.fingerprinted != name {
+		return nil, false, fs.ErrNotExist
+	}
+	return as, fingerprinted, nil
+}
+
+// indexBody returns index.html with references to the fingerprinted names of
+// the assets, which may be cached forever.
+func (a *assets) indexBody() (*cachedBody, error) {
+	if _, _, err := a.lookup("index.html"); err != nil {
+		return nil, err
+	}
+	// The referenced assets are checked as well, since their fingerprints
+	// change with their content.
+	a.mutex.RLock()
+	references := a.references
+	a.mutex.RUnlock()
+	for _, name := range references {
+		if _, _, err := a.lookup(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	a.mutex.RLock()
+	if !a.stale {
+		defer a.mutex.RUnlock()
+		return a.index, nil
+	}
+	a.mutex.RUnlock()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	index := a.byName["index.html"].body.identity()
+	var referenced []string
+	rewritten := staticReference.ReplaceAllFunc(index, func(match []byte) []byte {
+		groups := staticReference.FindSubmatch(match)
+		as, ok := a.byName[string(groups[2])]
+		if !ok {
+			return match
+		}
+		referenced = append(referenced, as.name)
+		return []byte(string(groups[1]) + "static/" + as.fingerprinted + string(groups[3]))
+	})
+	body, err := newCachedBody("text/html; charset=utf-8", rewritten, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	a.index, a.stale, a.references = body, false, referenced
+	return body, nil
+}
+
+func (a *assets) indexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+	body, err := a.indexBody()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+	serveCached(w, r, body, "no-cache")
+}
+
+// staticHandler serves the assets below /static/. Fingerprinted names are
+// cached forever, whereas others have to be revalidated.
+func (a *assets) staticHandler(w http.ResponseWriter, r *http.Request) {
+	as, fingerprinted, err := a.lookup(strings.TrimPrefix(r.URL.Path, "/static/"))
+	if err != nil {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+	cacheControl := "no-cache"
+	if fingerprinted {
+		cacheControl = immutable
+	}
+	serveCached(w, r, as.body, cacheControl)
+}
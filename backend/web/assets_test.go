@@ -0,0 +1,70 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestAssets(t *testing.T) {
+	script := []byte(strings.Repeat("console.log('parken');\n", 64))
+	fsys := fstest.MapFS{
+		"index.html":  {Data: []byte(`<script src="static/parken.js"></script><img src="static/logo.png">`), ModTime: testUpdated},
+		"parken.js":   {Data: script, ModTime: testUpdated},
+		"logo.png":    {Data: []byte("\x89PNG\r\n\x1a\n"), ModTime: testUpdated},
+		"generate.go": {Data: []byte("package frontend\n"), ModTime: testUpdated},
+	}
+	a, err := newAssets(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, logo := fingerprint("parken.js", script), fingerprint("logo.png", fsys["logo.png"].Data)
+	tests := []struct {
+		handler      http.HandlerFunc
+		target       string
+		header       []string
+		status       int
+		cacheControl string
+		encoding     string
+	}{
+		{a.indexHandler, "/", nil, http.StatusOK, "no-cache", ""},
+		{a.indexHandler, "/", []string{"Accept-Encoding", "gzip"}, http.StatusOK, "no-cache", "gzip"},
+		{a.indexHandler, "/index.html", nil, http.StatusNotFound, "", ""},
+		{a.staticHandler, "/static/parken.js", nil, http.StatusOK, "no-cache", ""},
+		{a.staticHandler, "/static/" + js, nil, http.StatusOK, immutable, ""},
+		{a.staticHandler, "/static/" + js, []string{"Accept-Encoding", "gzip, br"}, http.StatusOK, immutable, "br"},
+		{a.staticHandler, "/static/" + logo, []string{"Accept-Encoding", "gzip"}, http.StatusOK, immutable, ""},
+		{a.staticHandler, "/static/missing.js", nil, http.StatusNotFound, "", ""},
+		{a.staticHandler, "/static/generate.go", nil, http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		w := serve(test.handler, test.target, test.header...)
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.target, w.Code, test.status)
+			continue
+		}
+		if cacheControl := w.Header().Get("Cache-Control"); cacheControl != test.cacheControl {
+			t.Errorf("%s: got Cache-Control %q, want %q", test.target, cacheControl, test.cacheControl)
+		}
+		if encoding := w.Header().Get("Content-Encoding"); encoding != test.encoding {
+			t.Errorf("%s: got Content-Encoding %q, want %q", test.target, encoding, test.encoding)
+		}
+	}
+	index := serve(a.indexHandler, "/").Body.String()
+	if !strings.Contains(index, `src="static/`+js+`"`) || !strings.Contains(index, `src="static/`+logo+`"`) {
+		t.Errorf("index does not reference the fingerprinted assets: %s", index)
+	}
+
+	// A changed file is reloaded along with the index referencing it.
+	changed := append(append([]byte(nil), script...), "console.log('changed');\n"...)
+	fsys["parken.js"] = &fstest.MapFile{Data: changed, ModTime: testUpdated.Add(time.Minute)}
+	if w := serve(a.staticHandler, "/static/"+js); w.Code != http.StatusNotFound {
+		t.Errorf("previous fingerprint: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	index = serve(a.indexHandler, "/").Body.String()
+	if !strings.Contains(index, `src="static/`+fingerprint("parken.js", changed)+`"`) {
+		t.Errorf("index does not reference the changed asset: %s", index)
+	}
+}
@@ -0,0 +1,228 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// encodings lists the supported content codings in order of preference.
+var encodings = []string{"br", "gzip", "identity"}
+
+// brotliLevel is below brotli.BestCompression, which takes about ten times as
+// long for a few percent smaller output.
+const brotliLevel = 9
+
+// cachedBody is a serialised response body along with its compressed variants
+// and validators.
+type cachedBody struct {
+	contentType string
+	variants    map[string][]byte
+	etag        string
+	modified    time.Time
+}
+
+func compress(encoding string, data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	var w interface {
+		Write([]byte) (int, error)
+		Close() error
+	}
+	switch encoding {
+	case "gzip":
+		w, _ = gzip.NewWriterLevel(&b, gzip.BestCompression)
+	case "br":
+		w = brotli.NewWriterLevel(&b, brotliLevel)
+	default:
+		return data, nil
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// compressible reports whether bodies of the content type benefit from
+// compression. Images and modern font formats are compressed already.
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch {
+	case strings.HasPrefix(mediaType, "text/"), strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "javascript"), strings.HasSuffix(mediaType, "xml"),
+		mediaType == "image/svg+xml", mediaType == "font/ttf", mediaType == "font/otf",
+		mediaType == "application/msgpack":
+		return true
+	}
+	return false
+}
+
+// newCachedBody compresses the body if its content type is compressible. The
+// strong entity tag is derived from the time of modification, if given, and
+// the content, since the snapshot may change without an update of the upstream
+// data, for example after geocoding.
+func newCachedBody(contentType string, data []byte, modified time.Time) (*cachedBody, error) {
+	sum := sha256.Sum256(data)
+	c := &cachedBody{contentType: contentType, variants: make(map[string][]byte), modified: modified,
+		etag: hex.EncodeToString(sum[:8])}
+	if !modified.IsZero() {
+		c.etag = fmt.Sprintf("%x-%s", modified.Unix(), c.etag)
+	}
+	for _, encoding := range encodings {
+		if encoding != "identity" && !compressible(contentType) {
+			continue
+		}
+		variant, err := compress(encoding, data)
+		if err != nil {
+			return nil, fmt.Errorf("compressing with %s: %w", encoding, err)
+		}
+		c.variants[encoding] = variant
+	}
+	return c, nil
+}
+
+func (c *cachedBody) identity() []byte {
+	return c.variants["identity"]
+}
+
+// encodings returns the available content codings in order of preference.
+func (c *cachedBody) encodings() []string {
+	available := make([]string, 0, len(c.variants))
+	for _, encoding := range encodings {
+		if _, ok := c.variants[encoding]; ok {
+			available = append(available, encoding)
+		}
+	}
+	return available
+}
+
+// entityTag returns the entity tag of a variant. Variants have distinct tags,
+// as strong validators must differ between representations.
+func (c *cachedBody) entityTag(encoding string) string {
+	if encoding == "identity" {
+		return `"` + c.etag + `"`
+	}
+	return `"` + c.etag + "-" + encoding + `"`
+}
+
+// acceptedEncodings parses an Accept-Encoding header into the quality values of
+// the listed codings.
+func acceptedEncodings(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, element := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(element, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = math.Max(0, math.Min(1, parsed))
+			}
+		}
+		accepted[coding] = q
+	}
+	return accepted
+}
+
+// negotiateEncoding selects the available coding with the highest quality in
+// the Accept-Encoding header. Ties are broken by the order of available. It
+// reports false if no available coding is acceptable.
+func negotiateEncoding(header string, available []string) (string, bool) {
+	accepted := acceptedEncodings(header)
+	quality := func(coding string) float64 {
+		if q, ok := accepted[coding]; ok {
+			return q
+		}
+		if q, ok := accepted["*"]; ok {
+			return q
+		}
+		// Without an explicit refusal, identity is always acceptable.
+		if coding == "identity" {
+			return 0.001
+		}
+		return 0
+	}
+	best, bestQ := "", 0.0
+	for _, coding := range available {
+		if q := quality(coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best, best != ""
+}
+
+// notModified evaluates the conditional headers of a GET or HEAD request.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if strings.TrimSpace(inm) == "*" {
+			return true
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			// If-None-Match uses the weak comparison.
+			if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// publicMaxAge returns a Cache-Control value allowing shared caches to store a
+// response for the given duration.
+func publicMaxAge(maxAge time.Duration) string {
+	return fmt.Sprintf("public, max-age=%d", int(math.Ceil(maxAge.Seconds())))
+}
+
+// serveCached writes the variant of the body matching the request's
+// Accept-Encoding, or 304 Not Modified if the client's copy is current.
+func serveCached(w http.ResponseWriter, r *http.Request, c *cachedBody, cacheControl string) {
+	h := w.Header()
+	h.Add("Vary", "Accept-Encoding")
+	encoding, ok := negotiateEncoding(r.Header.Get("Accept-Encoding"), c.encodings())
+	if !ok {
+		httpError(w, http.StatusNotAcceptable)
+		return
+	}
+	etag := c.entityTag(encoding)
+	h.Set("ETag", etag)
+	if !c.modified.IsZero() {
+		h.Set("Last-Modified", c.modified.UTC().Format(http.TimeFormat))
+	}
+	h.Set("Cache-Control", cacheControl)
+	if notModified(r, etag, c.modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body := c.variants[encoding]
+	h.Set("Content-Type", c.contentType)
+	if encoding != "identity" {
+		h.Set("Content-Encoding", encoding)
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
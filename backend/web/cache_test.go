@@ -0,0 +1,63 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+func TestParkingsCaching(t *testing.T) {
+	s := newTestServer(t, parken.Parking{ID: 1, Spots: 10})
+	first := serve(s.parkingsHandler, "/api/parkings")
+	etag, modified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || etag == "" || modified != testUpdated.Format(http.TimeFormat) {
+		t.Fatalf("got status %d, ETag %q and Last-Modified %q", first.Code, etag, modified)
+	}
+	gzipped := serve(s.parkingsHandler, "/api/parkings", "Accept-Encoding", "gzip")
+	gzipETag := gzipped.Header().Get("ETag")
+	if gzipETag == etag {
+		t.Errorf("the gzip variant has the ETag %s of the identity", etag)
+	}
+	earlier := testUpdated.Add(-time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name     string
+		header   []string
+		status   int
+		encoding string
+	}{
+		{"unconditional", nil, http.StatusOK, ""},
+		{"matching ETag", []string{"If-None-Match", etag}, http.StatusNotModified, ""},
+		{"weak ETag", []string{"If-None-Match", "W/" + etag}, http.StatusNotModified, ""},
+		{"ETag in list", []string{"If-None-Match", `"other", ` + etag}, http.StatusNotModified, ""},
+		{"other ETag", []string{"If-None-Match", `"other"`}, http.StatusOK, ""},
+		{"any ETag", []string{"If-None-Match", "*"}, http.StatusNotModified, ""},
+		{"not modified since", []string{"If-Modified-Since", modified}, http.StatusNotModified, ""},
+		{"modified since", []string{"If-Modified-Since", earlier}, http.StatusOK, ""},
+		{"ETag before date", []string{"If-None-Match", `"other"`, "If-Modified-Since", modified}, http.StatusOK, ""},
+		{"ETag of other variant", []string{"Accept-Encoding", "gzip", "If-None-Match", etag}, http.StatusOK, "gzip"},
+		{"gzip ETag", []string{"Accept-Encoding", "gzip", "If-None-Match", gzipETag}, http.StatusNotModified, ""},
+		{"preferred coding", []string{"Accept-Encoding", "gzip, br"}, http.StatusOK, "br"},
+		{"quality values", []string{"Accept-Encoding", "br;q=0.5, gzip"}, http.StatusOK, "gzip"},
+		{"refused identity", []string{"Accept-Encoding", "identity;q=0, *;q=0"}, http.StatusNotAcceptable, ""},
+	}
+	for _, test := range tests {
+		w := serve(s.parkingsHandler, "/api/parkings", test.header...)
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+		if encoding := w.Header().Get("Content-Encoding"); encoding != test.encoding {
+			t.Errorf("%s: got Content-Encoding %q, want %q", test.name, encoding, test.encoding)
+		}
+		if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("%s: 304 response has a body", test.name)
+		}
+	}
+
+	s.setTestSnapshot(t, testUpdated.Add(time.Minute), parken.Parking{ID: 1, Spots: 8})
+	if w := serve(s.parkingsHandler, "/api/parkings", "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("after an update: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
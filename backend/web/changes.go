@@ -0,0 +1,114 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+// changesBacklog is the number of past snapshots kept for clients polling for
+// changes.
+const changesBacklog = 64
+
+// version is a past snapshot of the parkings. Its sequence number identifies
+// it, since snapshots rebuilt without a scrape, e.g. after geocoding, share
+// their time.
+type version struct {
+	sequence uint64
+	updated  time.Time
+	parkings []parken.Parking
+}
+
+// recordVersion keeps the snapshot as a base for changes. The caller must hold
+// s.mutex.
+func (s *Server) recordVersion(updated time.Time, parkings []parken.Parking) {
+	var sequence uint64
+	if len(s.versions) != 0 {
+		sequence = s.versions[len(s.versions)-1].sequence + 1
+	}
+	if len(s.versions) == changesBacklog {
+		s.evicted = s.versions[0].updated
+		s.versions = s.versions[1:]
+	}
+	s.versions = append(s.versions, version{sequence, updated, parkings})
+}
+
+// currentVersion returns the sequence number of the current snapshot. The
+// caller must hold s.mutex.
+func (s *Server) currentVersion() uint64 {
+	if len(s.versions) == 0 {
+		return 0
+	}
+	return s.versions[len(s.versions)-1].sequence
+}
+
+// versionBySequence returns the parkings of the snapshot with the given
+// sequence number. The caller must hold s.mutex.
+func (s *Server) versionBySequence(sequence uint64) ([]parken.Parking, bool) {
+	for _, v := range s.versions {
+		if v.sequence == sequence {
+			return v.parkings, true
+		}
+	}
+	return nil, false
+}
+
+// baseVersion returns the parkings of the snapshot updated at the given time.
+// Snapshots rebuilt without a scrape share their time, in which case the
+// earliest one is returned, so that no change is missed. If the earliest one
+// has been dropped already, there is none. The caller must hold s.mutex.
+func (s *Server) baseVersion(updated time.Time) ([]parken.Parking, bool) {
+	if updated.Equal(s.evicted) {
+		return nil, false
+	}
+	for _, v := range s.versions {
+		if v.updated.Equal(updated) {
+			return v.parkings, true
+		}
+	}
+	return nil, false
+}
+
+type changesResponse struct {
+	delta
+	// Version is the sequence number of the current snapshot, which is
+	// passed as version when polling for the next changes.
+	Version uint64 `json:"version"`
+	// Resync is set if the requested snapshot is not available anymore, in
+	// which case Parkings contains all parkings.
+	Resync bool `json:"resync"`
+}
+
+// changesHandler serves the parkings that were added or changed since the
+// snapshot with the sequence number given by version, or the one updated at the
+// time given by since, and the IDs of the removed ones.
+func (s *Server) changesHandler(w http.ResponseWriter, r *http.Request) {
+	var base func() ([]parken.Parking, bool)
+	if v := r.FormValue("version"); v != "" {
+		sequence, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			httpError(w, http.StatusBadRequest)
+			return
+		}
+		base = func() ([]parken.Parking, bool) { return s.versionBySequence(sequence) }
+	} else {
+		since, err := time.Parse(time.RFC3339, r.FormValue("since"))
+		if err != nil {
+			httpError(w, http.StatusBadRequest)
+			return
+		}
+		base = func() ([]parken.Parking, bool) { return s.baseVersion(since) }
+	}
+	s.mutex.RLock()
+	updated, parkings, current := s.updated, s.parkings, s.currentVersion()
+	previous, ok := base()
+	s.mutex.RUnlock()
+	res := changesResponse{delta: delta{Updated: updated, Parkings: parkings, Removed: []int{}}, Version: current, Resync: !ok}
+	if ok {
+		res.Parkings, res.Removed = diffParkings(previous, parkings)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	s.writeAPI(w, r, res)
+}
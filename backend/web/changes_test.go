@@ -0,0 +1,82 @@
+package web
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+func changes(t *testing.T, s *Server, query string) changesResponse {
+	t.Helper()
+	w := serve(s.changesHandler, "/api/parkings/changes?"+query)
+	if w.Code != 200 {
+		t.Fatalf("GET /api/parkings/changes?%s: status %d", query, w.Code)
+	}
+	var res changesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestChanges(t *testing.T) {
+	since := testUpdated.Format(time.RFC3339)
+	s := newTestServer(t, parken.Parking{ID: 1, Spots: 10}, parken.Parking{ID: 2, Spots: 5})
+	first := changes(t, s, "since="+since).Version
+
+	// A refresh after geocoding keeps the time of the snapshot.
+	s.setTestSnapshot(t, testUpdated, parken.Parking{ID: 1, Spots: 10, Name: "Kornmarkt"}, parken.Parking{ID: 2, Spots: 5})
+	s.setTestSnapshot(t, testUpdated.Add(time.Minute), parken.Parking{ID: 1, Spots: 8, Name: "Kornmarkt"})
+
+	tests := []struct {
+		query   string
+		resync  bool
+		changed []int
+		removed []int
+	}{
+		{"since=" + since, false, []int{1}, []int{2}},
+		{"version=" + strconv.FormatUint(first, 10), false, []int{1}, []int{2}},
+		{"version=" + strconv.FormatUint(first+1, 10), false, []int{1}, []int{2}},
+		{"version=" + strconv.FormatUint(first+2, 10), false, nil, nil},
+		{"version=" + strconv.FormatUint(first+3, 10), true, []int{1}, nil},
+		{"since=" + testUpdated.Add(-time.Minute).Format(time.RFC3339), true, []int{1}, nil},
+	}
+	for _, test := range tests {
+		res := changes(t, s, test.query)
+		if res.Version != first+2 || res.Resync != test.resync || len(res.Parkings) != len(test.changed) || len(res.Removed) != len(test.removed) {
+			t.Errorf("%s: version %d, resync %t, %d changed, removed %v", test.query, res.Version, res.Resync, len(res.Parkings), res.Removed)
+		}
+	}
+	for _, query := range []string{"", "since=yesterday", "version=-1"} {
+		if w := serve(s.changesHandler, "/api/parkings/changes?"+query); w.Code != 400 {
+			t.Errorf("%q: status %d, want 400", query, w.Code)
+		}
+	}
+}
+
+// TestChangesEvicted checks that changes since a snapshot whose earliest
+// version left the backlog require a resync, even if later versions share
+// its time.
+func TestChangesEvicted(t *testing.T) {
+	since := "since=" + testUpdated.Format(time.RFC3339)
+	s := newTestServer(t, parken.Parking{ID: 1, Spots: 10})
+	first := changes(t, s, since).Version
+	for i := 1; i < changesBacklog; i++ {
+		s.setTestSnapshot(t, testUpdated, parken.Parking{ID: 1, Spots: 10, Name: strconv.Itoa(i)})
+	}
+	if res := changes(t, s, since); res.Resync || len(res.Parkings) != 1 {
+		t.Fatalf("changes before eviction: resync %t, %d changed", res.Resync, len(res.Parkings))
+	}
+	s.setTestSnapshot(t, testUpdated, parken.Parking{ID: 1, Spots: 10, Name: "evicting"})
+	for _, query := range []string{since, "version=" + strconv.FormatUint(first, 10)} {
+		if res := changes(t, s, query); !res.Resync {
+			t.Errorf("%s after eviction: no resync", query)
+		}
+	}
+	if res := changes(t, s, "version="+strconv.FormatUint(first+1, 10)); res.Resync {
+		t.Error("changes since the earliest version kept: resync")
+	}
+}
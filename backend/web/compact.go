@@ -0,0 +1,124 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// apiFormats are the formats of the JSON resources of the API, the first of
+// which is the default.
+var apiFormats = []string{"json", "msgpack"}
+
+// compactValue removes empty and zero values from a value decoded from JSON
+// with numbers preserved as json.Number. It reports false if the value itself
+// is empty.
+func compactValue(v any) (any, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, false
+	case bool:
+		return v, v
+	case string:
+		return v, v != ""
+	case json.Number:
+		f, err := v.Float64()
+		return v, err != nil || f != 0
+	case []any:
+		// Elements are kept, as their position is significant.
+		for i, element := range v {
+			v[i], _ = compactValue(element)
+		}
+		return v, len(v) != 0
+	case map[string]any:
+		for key, member := range v {
+			if compacted, ok := compactValue(member); ok {
+				v[key] = compacted
+			} else {
+				delete(v, key)
+			}
+		}
+		return v, len(v) != 0
+	}
+	return v, true
+}
+
+// represent converts a JSON document into the given format, either json or
+// msgpack. In compact mode, empty and zero values are left out, so that absent
+// members have their zero value. The source is the value the JSON was
+// marshalled from, whose types determine the encoding of numbers in
+// MessagePack. It may be nil.
+func represent(data []byte, format string, compact bool, source any) ([]byte, error) {
+	if format == "json" && !compact {
+		return data, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if compact {
+		v, _ = compactValue(v)
+	}
+	if format == "msgpack" {
+		return encodeMsgpack(v, reflect.ValueOf(source))
+	}
+	return json.Marshal(v)
+}
+
+// compactMode reports whether the response is requested in compact mode. The
+// parameter compact takes precedence over the default of the API version,
+// which is compact for v2.
+func compactMode(r *http.Request) (bool, error) {
+	if v := r.URL.Query().Get("compact"); v != "" {
+		return strconv.ParseBool(v)
+	}
+	prefix, _ := apiPath(r)
+	return prefix == apiV2Prefix, nil
+}
+
+// writeAPI writes a resource of the API in the negotiated format and mode.
+func (s *Server) writeAPI(w http.ResponseWriter, r *http.Request, v any) {
+	format, code := negotiateFormat(r, apiFormats)
+	if code != 0 {
+		httpError(w, code)
+		return
+	}
+	compact, err := compactMode(r)
+	if err != nil {
+		httpError(w, http.StatusBadRequest)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	data, err := json.Marshal(v)
+	if err == nil {
+		data, err = represent(data, format, compact, v)
+	}
+	if err != nil {
+		s.log().Error("marshalling response", "error", err)
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Write(data)
+}
+
+// snapshotCache holds the precomputed representations of a snapshot.
+type snapshotCache struct {
+	json, compactJSON, msgpack, compactMsgpack *cachedBody
+}
+
+func (c *snapshotCache) get(format string, compact bool) *cachedBody {
+	switch {
+	case format == "msgpack" && compact:
+		return c.compactMsgpack
+	case format == "msgpack":
+		return c.msgpack
+	case compact:
+		return c.compactJSON
+	}
+	return c.json
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/relseah/parken"
+)
+
+func TestCompactMode(t *testing.T) {
+	s := newTestServer(t, parken.Parking{ID: 1, Name: "Kornmarkt", Address: parken.Address{Street: "Hauptstraße"}, Capacity: 50},
+		parken.Parking{ID: 2, Spots: 3, OpenAllDay: true})
+	full := map[string]bool{"id": true, "name": true, "capacity": true, "spots": true, "openAllDay": true,
+		"operator": true, "coordinates": true}
+	compact := map[string]bool{"id": true, "name": true, "capacity": true}
+	tests := []struct {
+		target string
+		status int
+		// members are the members present in the first parking, whose
+		// address has a postal code if postalCode is set.
+		members    map[string]bool
+		postalCode bool
+	}{
+		{"/api/parkings", http.StatusOK, full, true},
+		{"/api/v1/parkings?compact=false", http.StatusOK, full, true},
+		{"/api/parkings?compact=true", http.StatusOK, compact, false},
+		{"/api/v2/parkings", http.StatusOK, compact, false},
+		{"/api/v2/parkings?compact=0", http.StatusOK, full, true},
+		{"/api/parkings?compact=maybe", http.StatusBadRequest, nil, false},
+	}
+	for _, test := range tests {
+		w := serve(s.parkingsHandler, test.target)
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.target, w.Code, test.status)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		var res struct {
+			Parkings []map[string]any `json:"parkings"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: %v", test.target, err)
+		}
+		if len(res.Parkings) != 2 {
+			t.Fatalf("%s: got %d parkings, want 2", test.target, len(res.Parkings))
+		}
+		for member := range full {
+			if _, ok := res.Parkings[0][member]; ok != test.members[member] {
+				t.Errorf("%s: member %s is present: %t, want %t", test.target, member, ok, test.members[member])
+			}
+		}
+		address, _ := res.Parkings[0]["address"].(map[string]any)
+		if _, ok := address["postalCode"]; ok != test.postalCode || address["street"] != "Hauptstraße" {
+			t.Errorf("%s: got address %v", test.target, address)
+		}
+		// Non-zero values are kept in compact mode.
+		if res.Parkings[1]["spots"] != 3.0 || res.Parkings[1]["openAllDay"] != true {
+			t.Errorf("%s: got second parking %v", test.target, res.Parkings[1])
+		}
+	}
+}
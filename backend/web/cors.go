@@ -0,0 +1,97 @@
+package web
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodHead}
+	// corsHeaders are the request headers clients may send.
+	corsHeaders = "Accept, If-None-Match, Last-Event-ID, X-API-Key"
+	// corsExposedHeaders are the response headers clients may read.
+	corsExposedHeaders = "ETag, Retry-After, WWW-Authenticate"
+)
+
+// CORS configures cross-origin requests to the API.
+type CORS struct {
+	// AllowedOrigins are the origins that may call the API. The origin * allows
+	// all of them, and a * in the host of an origin matches its subdomains,
+	// for instance https://*.example.org. CORS is disabled if there are none.
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET and HEAD.
+	AllowedMethods []string
+	// MaxAge is the time for which preflight responses may be cached.
+	MaxAge time.Duration
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for
+// the origin, which is empty if it is not allowed.
+func (c CORS) allowOrigin(origin string) string {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if allowed == origin {
+			return origin
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok && strings.HasPrefix(origin, prefix) &&
+			strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+			subdomain := origin[len(prefix) : len(origin)-len(suffix)]
+			if !strings.ContainsAny(subdomain, "/:") {
+				return origin
+			}
+		}
+	}
+	return ""
+}
+
+func (c CORS) methods() []string {
+	if len(c.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return c.AllowedMethods
+}
+
+// cors adds the CORS headers to the responses of the handler and answers
+// preflight requests.
+func (s *Server) cors(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := s.CORS
+		if len(c.AllowedOrigins) == 0 {
+			handler(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		allowed := ""
+		if origin != "" {
+			allowed = c.allowOrigin(origin)
+		}
+		if !preflight {
+			if allowed != "" {
+				h.Set("Access-Control-Allow-Origin", allowed)
+				h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			}
+			handler(w, r)
+			return
+		}
+		methods := c.methods()
+		if allowed == "" || !slices.Contains(methods, r.Header.Get("Access-Control-Request-Method")) {
+			httpError(w, http.StatusForbidden)
+			return
+		}
+		h.Set("Access-Control-Allow-Origin", allowed)
+		h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		h.Set("Access-Control-Allow-Headers", corsHeaders)
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
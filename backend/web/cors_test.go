@@ -0,0 +1,71 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	s := newTestServer(t)
+	s.CORS = CORS{AllowedOrigins: []string{"https://parken.example", "https://*.example.org"}, MaxAge: time.Hour}
+	handler := s.cors(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name          string
+		method        string
+		origin        string
+		requestMethod string
+		status        int
+		allowOrigin   string
+		// preflight reports whether the headers of preflight responses are
+		// expected.
+		preflight bool
+	}{
+		{"simple request", http.MethodGet, "https://parken.example", "", http.StatusOK, "https://parken.example", false},
+		{"without origin", http.MethodGet, "", "", http.StatusOK, "", false},
+		{"unknown origin", http.MethodGet, "https://evil.example", "", http.StatusOK, "", false},
+		{"preflight", http.MethodOptions, "https://parken.example", http.MethodGet, http.StatusNoContent, "https://parken.example", true},
+		{"preflight of subdomain", http.MethodOptions, "https://maps.example.org", http.MethodHead, http.StatusNoContent, "https://maps.example.org", true},
+		{"preflight of nested subdomain", http.MethodOptions, "https://a.b.example.org", http.MethodGet, http.StatusNoContent, "https://a.b.example.org", true},
+		{"preflight of bare domain", http.MethodOptions, "https://example.org", http.MethodGet, http.StatusForbidden, "", false},
+		{"preflight with port in subdomain", http.MethodOptions, "https://evil.example:443.example.org", http.MethodGet, http.StatusForbidden, "", false},
+		{"preflight of unknown origin", http.MethodOptions, "https://evil.example", http.MethodGet, http.StatusForbidden, "", false},
+		{"preflight of disallowed method", http.MethodOptions, "https://parken.example", http.MethodDelete, http.StatusForbidden, "", false},
+		{"options without preflight", http.MethodOptions, "https://parken.example", "", http.StatusOK, "https://parken.example", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/api/parkings", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.requestMethod != "" {
+			r.Header.Set("Access-Control-Request-Method", test.requestMethod)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		h := w.Header()
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+		if allowOrigin := h.Get("Access-Control-Allow-Origin"); allowOrigin != test.allowOrigin {
+			t.Errorf("%s: got Access-Control-Allow-Origin %q, want %q", test.name, allowOrigin, test.allowOrigin)
+		}
+		if h.Get("Vary") != "Origin" {
+			t.Errorf("%s: got Vary %q, want Origin", test.name, h.Get("Vary"))
+		}
+		if preflight := h.Get("Access-Control-Allow-Methods") != ""; preflight != test.preflight {
+			t.Errorf("%s: got Access-Control-Allow-Methods %q", test.name, h.Get("Access-Control-Allow-Methods"))
+		}
+		if test.preflight && (h.Get("Access-Control-Allow-Headers") != corsHeaders || h.Get("Access-Control-Max-Age") != "3600") {
+			t.Errorf("%s: got Access-Control-Allow-Headers %q and Access-Control-Max-Age %q", test.name,
+				h.Get("Access-Control-Allow-Headers"), h.Get("Access-Control-Max-Age"))
+		}
+	}
+
+	s.CORS = CORS{}
+	w := serve(handler, "/api/parkings", "Origin", "https://parken.example")
+	if len(w.Header()) != 0 {
+		t.Errorf("without allowed origins: got header %v", w.Header())
+	}
+}
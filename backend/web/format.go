@@ -0,0 +1,302 @@
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+// contentTypes maps the supported formats to their content types.
+var contentTypes = map[string]string{
+	"json":    "application/json",
+	"msgpack": "application/msgpack",
+	"csv":     "text/csv; charset=utf-8",
+	"geojson": "application/geo+json",
+	"xml":     "application/xml; charset=utf-8",
+}
+
+// mediaTypes maps the supported formats to the media types they are requested
+// with.
+var mediaTypes = map[string][]string{
+	"json":    {"application/json"},
+	"msgpack": {"application/msgpack", "application/vnd.msgpack", "application/x-msgpack"},
+	"csv":     {"text/csv"},
+	"geojson": {"application/geo+json"},
+	"xml":     {"application/xml", "text/xml"},
+}
+
+// negotiateFormat selects the format of the response from the available ones,
+// the first of which is the default. The parameter format takes precedence
+// over the Accept header, which is ignored for browsers navigating to the API.
+// It returns the status code of the error if no format is acceptable.
+func negotiateFormat(r *http.Request, available []string) (string, int) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if !slices.Contains(available, format) {
+			return "", http.StatusBadRequest
+		}
+		return format, 0
+	}
+	header := r.Header.Get("Accept")
+	if header == "" || strings.Contains(header, "text/html") {
+		return available[0], 0
+	}
+	accepted := acceptedEncodings(header)
+	quality := func(mediaType string) float64 {
+		if q, ok := accepted[mediaType]; ok {
+			return q
+		}
+		major, _, _ := strings.Cut(mediaType, "/")
+		if q, ok := accepted[major+"/*"]; ok {
+			return q
+		}
+		return accepted["*/*"]
+	}
+	best, bestQ := "", 0.0
+	for _, format := range available {
+		for _, mediaType := range mediaTypes[format] {
+			if q := quality(mediaType); q > bestQ {
+				best, bestQ = format, q
+			}
+		}
+	}
+	if best == "" {
+		return "", http.StatusNotAcceptable
+	}
+	return best, 0
+}
+
+// field describes a member of the JSON representation of a type, which has
+// fields itself if it is an object.
+type field struct {
+	name   string
+	fields []field
+}
+
+// layoutOf returns the members of the JSON representation of the struct type
+// in the order of its fields.
+func layoutOf(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, layoutOf(f.Type)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		member := field{name: name}
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}) && f.Type != reflect.TypeOf(parken.URL{}) {
+			member.fields = layoutOf(f.Type)
+		}
+		fields = append(fields, member)
+	}
+	return fields
+}
+
+// parkingLayout is the layout of parkings, which have a distance if they are
+// queried near a location and the time of their sample if they are
+// reconstructed.
+var parkingLayout = append(layoutOf(reflect.TypeOf(parken.Parking{})), field{name: "distance"}, field{name: "sampled"}, field{name: "stale"})
+
+// decodeRecord decodes a serialised parking, preserving the representation of
+// numbers.
+func decodeRecord(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var record map[string]any
+	return record, dec.Decode(&record)
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// columns returns the paths of the values of the records in the order of the
+// layout. Members of objects are flattened into separate columns.
+func columns(layout []field, records []map[string]any) [][]string {
+	present := make(map[string]bool)
+	for _, record := range records {
+		for name := range record {
+			present[name] = true
+		}
+	}
+	var paths [][]string
+	for _, f := range layout {
+		if !present[f.name] {
+			continue
+		}
+		if f.fields == nil {
+			paths = append(paths, []string{f.name})
+			continue
+		}
+		for _, member := range f.fields {
+			paths = append(paths, []string{f.name, member.name})
+		}
+	}
+	return paths
+}
+
+func lookup(record map[string]any, path []string) any {
+	var v any = record
+	for _, name := range path {
+		object, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = object[name]
+	}
+	return v
+}
+
+// encodeCSV writes a row per parking. Columns are named after the innermost
+// member.
+func encodeCSV(records []map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	paths := columns(parkingLayout, records)
+	row := make([]string, len(paths))
+	for i, path := range paths {
+		row[i] = path[len(path)-1]
+	}
+	w.Write(row)
+	for _, record := range records {
+		for i, path := range paths {
+			row[i] = formatValue(lookup(record, path))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+type geoJSONGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string           `json:"type"`
+	ID         int              `json:"id"`
+	Geometry   *geoJSONGeometry `json:"geometry"`
+	Properties map[string]any   `json:"properties"`
+}
+
+// encodeGeoJSON writes a FeatureCollection with a point per parking. Parkings
+// whose location is unknown have no geometry.
+func encodeGeoJSON(updated time.Time, parkings []parken.Parking, records []map[string]any) ([]byte, error) {
+	features := make([]geoJSONFeature, len(parkings))
+	for i := range parkings {
+		p := &parkings[i]
+		properties := records[i]
+		delete(properties, "coordinates")
+		delete(properties, "locationPending")
+		features[i] = geoJSONFeature{Type: "Feature", ID: p.ID, Properties: properties}
+		if !p.LocationPending && p.Coordinates != (parken.Coordinates{}) {
+			features[i].Geometry = &geoJSONGeometry{Type: "Point", Coordinates: [2]float64{p.Coordinates.Longitude, p.Coordinates.Latitude}}
+		}
+	}
+	return json.Marshal(struct {
+		Type     string           `json:"type"`
+		Updated  time.Time        `json:"updated"`
+		Features []geoJSONFeature `json:"features"`
+	}{"FeatureCollection", updated, features})
+}
+
+// encodeElements writes an element per member of the object in the order of
+// the layout. Members without a value are left out.
+func encodeElements(enc *xml.Encoder, layout []field, object map[string]any) error {
+	for _, f := range layout {
+		v, ok := object[f.name]
+		if !ok || v == nil {
+			continue
+		}
+		start := xml.StartElement{Name: xml.Name{Local: f.name}}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if members, ok := v.(map[string]any); ok {
+			if err := encodeElements(enc, f.fields, members); err != nil {
+				return err
+			}
+		} else if err := enc.EncodeToken(xml.CharData(formatValue(v))); err != nil {
+			return err
+		}
+		if err := enc.EncodeToken(start.End()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeXML writes the zones and parkings as children of a parkings element.
+func encodeXML(updated time.Time, zones map[int]string, records []map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	root := xml.StartElement{Name: xml.Name{Local: "parkings"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "updated"}, Value: updated.Format(time.RFC3339)}}}
+	if err := enc.EncodeToken(root); err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(zones))
+	for id := range zones {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		zone := xml.StartElement{Name: xml.Name{Local: "zone"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "id"}, Value: strconv.Itoa(id)}}}
+		if err := enc.EncodeElement(zones[id], zone); err != nil {
+			return nil, err
+		}
+	}
+	parking := xml.StartElement{Name: xml.Name{Local: "parking"}}
+	for _, record := range records {
+		if err := enc.EncodeToken(parking); err != nil {
+			return nil, err
+		}
+		if err := encodeElements(enc, parkingLayout, record); err != nil {
+			return nil, err
+		}
+		if err := enc.EncodeToken(parking.End()); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
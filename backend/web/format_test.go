@@ -0,0 +1,63 @@
+package web
+
+import (
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/store"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	s := newTestServer(t, parken.Parking{ID: 1, Spots: 10})
+	s.SetStore(store.NewMemory())
+	tests := []struct {
+		target string
+		accept string
+		status int
+		// mediaType is the media type of the response.
+		mediaType string
+	}{
+		{"/api/parkings", "", http.StatusOK, "application/json"},
+		{"/api/parkings", "*/*", http.StatusOK, "application/json"},
+		{"/api/parkings", "text/csv", http.StatusOK, "text/csv"},
+		{"/api/parkings", "text/xml", http.StatusOK, "application/xml"},
+		{"/api/parkings", "application/x-msgpack", http.StatusOK, "application/msgpack"},
+		{"/api/parkings", "application/xml;q=0.5, text/csv;q=0.9", http.StatusOK, "text/csv"},
+		{"/api/parkings", "text/csv;q=0.1, application/geo+json", http.StatusOK, "application/geo+json"},
+		{"/api/parkings", "text/csv;q=0.1, application/*;q=0.2", http.StatusOK, "application/json"},
+		{"/api/parkings", "text/*, application/json;q=0.5", http.StatusOK, "text/csv"},
+		{"/api/parkings", "text/html,application/xhtml+xml,*/*;q=0.8", http.StatusOK, "application/json"},
+		{"/api/parkings", "image/png", http.StatusNotAcceptable, ""},
+		{"/api/parkings", "text/csv;q=0", http.StatusNotAcceptable, ""},
+		{"/api/parkings?format=csv", "application/json", http.StatusOK, "text/csv"},
+		{"/api/parkings?format=pdf", "", http.StatusBadRequest, ""},
+		{"/api/parkings/1/history", "text/csv", http.StatusOK, "text/csv"},
+		{"/api/parkings/1/history", "application/xml;q=0.9, application/json;q=0.8", http.StatusOK, "application/xml"},
+		{"/api/parkings/1/history", "application/geo+json", http.StatusNotAcceptable, ""},
+		{"/api/parkings/1/history?format=geojson", "", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		handler := s.parkingsHandler
+		if strings.HasPrefix(test.target, "/api/parkings/") {
+			handler = s.parkingHandler
+		}
+		w := serve(handler, test.target, "Accept", test.accept)
+		if w.Code != test.status {
+			t.Errorf("%s with %q: got status %d, want %d", test.target, test.accept, w.Code, test.status)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		if mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type")); mediaType != test.mediaType {
+			t.Errorf("%s with %q: got media type %q, want %s", test.target, test.accept, mediaType, test.mediaType)
+		}
+		if !slices.Contains(w.Header().Values("Vary"), "Accept") {
+			t.Errorf("%s with %q: got Vary %q, want Accept", test.target, test.accept, w.Header().Values("Vary"))
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package web
+
+import (
+	"math"
+
+	"github.com/relseah/parken"
+)
+
+// earthRadius is the mean radius of the earth in meters.
+const earthRadius = 6371008.8
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// distance returns the great-circle distance between a and b in meters.
+func distance(a, b parken.Coordinates) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat, dLon := lat2-lat1, radians(b.Longitude-a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// boundingBox is given by its south-west and north-east corners.
+type boundingBox struct {
+	min, max parken.Coordinates
+}
+
+func (b boundingBox) contains(c parken.Coordinates) bool {
+	return c.Latitude >= b.min.Latitude && c.Latitude <= b.max.Latitude &&
+		c.Longitude >= b.min.Longitude && c.Longitude <= b.max.Longitude
+}
@@ -0,0 +1,203 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/nominatim"
+	"github.com/relseah/parken/scraping"
+)
+
+const (
+	// geocodingWorkers is the number of concurrent geocoding requests, whose
+	// rate is limited by the client.
+	geocodingWorkers = 4
+	// geocodingQueueSize is the number of parkings waiting for geocoding.
+	// Parkings that do not fit into the queue are enqueued on the next scrape.
+	geocodingQueueSize = 256
+)
+
+// normalizeStreet makes the names of streets comparable. Words ending in
+// "str." are taken as abbreviations of "straße".
+func normalizeStreet(street string) string {
+	words := strings.Fields(strings.ReplaceAll(strings.ToLower(street), "strasse", "straße"))
+	for i, word := range words {
+		if strings.HasSuffix(word, "str.") {
+			words[i] = strings.TrimSuffix(word, ".") + "aße"
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func addressesAgree(a, b parken.Address) bool {
+	if a.PostalCode != 0 && b.PostalCode != 0 && a.PostalCode != b.PostalCode {
+		return false
+	}
+	return a.Street == "" || b.Street == "" || normalizeStreet(a.Street) == normalizeStreet(b.Street)
+}
+
+// completeAddress fills in missing fields of the parking's address.
+func completeAddress(p *parken.Parking, address parken.Address) {
+	if p.Address.Complete() {
+		return
+	}
+	if p.Address.Street == "" {
+		p.Address.Street, p.Address.HouseNumber = address.Street, address.HouseNumber
+	}
+	if p.Address.Town == "" {
+		p.Address.Town = address.Town
+	}
+	if p.Address.PostalCode == 0 {
+		p.Address.PostalCode = address.PostalCode
+	}
+}
+
+// locate sets the coordinates of the parking and completes its address as far
+// as they are known. It reports whether the parking still needs geocoding.
+// The caller must hold s.mutex.
+func (s *Server) locate(p *parken.Parking) bool {
+	var coordinates parken.Coordinates
+	if o := s.overrides[p.ID]; o.Coordinates != nil {
+		coordinates = *o.Coordinates
+	} else {
+		var ok bool
+		coordinates, ok = s.coordinates[p.ID]
+		if !ok {
+			coordinates, ok = s.presets[p.ID]
+		}
+		if !ok {
+			coordinates, ok = s.coordinatesDB[p.ID]
+		}
+		if !ok {
+			p.LocationPending = true
+			return true
+		}
+		s.coordinates[p.ID] = coordinates
+	}
+	p.Coordinates, p.LocationPending = coordinates, false
+	address, ok := s.addresses[p.ID]
+	if !ok {
+		return coordinates != parken.Coordinates{}
+	}
+	completeAddress(p, address)
+	return false
+}
+
+// enqueue queues the parking for geocoding unless it is queued already. The
+// caller must hold s.mutex.
+func (s *Server) enqueue(p parken.Parking) {
+	if s.pending[p.ID] {
+		return
+	}
+	select {
+	case s.geocoding <- p:
+		s.pending[p.ID] = true
+	default:
+	}
+}
+
+func (s *Server) startGeocoding() {
+	s.geocoding = make(chan parken.Parking, geocodingQueueSize)
+	s.geocodingDone = make(chan struct{})
+	for i := 0; i < geocodingWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case p := <-s.geocoding:
+					s.geocode(p)
+				case <-s.geocodingDone:
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *Server) stopGeocoding() {
+	s.geocodingOnce.Do(func() {
+		if s.geocodingDone != nil {
+			close(s.geocodingDone)
+		}
+	})
+}
+
+func (s *Server) searchCoordinates(p *parken.Parking) (parken.Coordinates, error) {
+	results, err := s.Client.Search(p)
+	if err != nil {
+		return parken.Coordinates{}, fmt.Errorf("searching for coordinates of parking with ID %d: %w", p.ID, err)
+	}
+	if len(results) == 0 {
+		s.log().Warn("no geocoding results", "parking_id", p.ID, "name", p.Name)
+	} else if len(results) > 1 {
+		s.log().Warn("multiple geocoding results", "parking_id", p.ID, "name", p.Name, "results", results)
+	} else {
+		coordinates := results[0]
+		s.dbMutex.Lock()
+		defer s.dbMutex.Unlock()
+		if s.Store() == nil {
+			return coordinates, nil
+		}
+		start := time.Now()
+		err = s.Store().SaveCoordinates(p.ID, coordinates)
+		s.metrics.recordInsert("coordinates", start, err)
+		return coordinates, err
+	}
+	return parken.Coordinates{}, nil
+}
+
+// geocode resolves the coordinates of the parking if they are pending and looks
+// up the address at its coordinates. Afterwards, the parking is updated in the
+// current snapshot. Parkings whose address disagrees with their coordinates
+// are logged.
+func (s *Server) geocode(p parken.Parking) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.pending, p.ID)
+		s.mutex.Unlock()
+	}()
+	if p.LocationPending {
+		coordinates, err := s.searchCoordinates(&p)
+		if err != nil {
+			s.log().Error("geocoding failed", "parking_id", p.ID, "error", err)
+			return
+		}
+		s.mutex.Lock()
+		s.coordinates[p.ID] = coordinates
+		s.mutex.Unlock()
+		p.Coordinates = coordinates
+	}
+	if p.Coordinates != (parken.Coordinates{}) {
+		address, err := s.Client.ReverseSearch(p.Coordinates)
+		if err != nil && !errors.Is(err, nominatim.ErrNoResult) {
+			s.log().Warn("reverse search failed", "parking_id", p.ID, "name", p.Name, "error", err)
+		} else {
+			s.mutex.Lock()
+			s.addresses[p.ID] = address
+			s.mutex.Unlock()
+			if !addressesAgree(p.Address, address) {
+				s.log().Warn("address disagrees with coordinates", "parking_id", p.ID, "name", p.Name,
+					"upstream", p.Address, "at_coordinates", address)
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	parkings := make([]parken.Parking, len(s.parkings))
+	copy(parkings, s.parkings)
+	for i := 0; i < len(parkings); i++ {
+		if parkings[i].ID == p.ID {
+			s.locate(&parkings[i])
+		}
+	}
+	res := scraping.Result{Updated: s.updated, Zones: s.zones, Parkings: parkings}
+	cache, err := newSnapshotCache(res)
+	if err != nil {
+		s.log().Error("caching snapshot", "parking_id", p.ID, "error", err)
+		return
+	}
+	s.setSnapshot(res, cache)
+}
@@ -0,0 +1,39 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/scraping"
+)
+
+func TestAddressesAgree(t *testing.T) {
+	tests := []struct {
+		upstream string
+		geocoded parken.Address
+		agree    bool
+	}{
+		{"Poststraße 20, 69115 Heidelberg", parken.Address{Street: "Poststraße", PostalCode: 69115}, true},
+		{"Poststr. 20, 69115 Heidelberg", parken.Address{Street: "Poststraße", PostalCode: 69115}, true},
+		{"Bergheimer Str. 147, 69115 Heidelberg", parken.Address{Street: "Bergheimer Straße", PostalCode: 69115}, true},
+		{"Sofienstrasse 7, 69115 Heidelberg", parken.Address{Street: "Sofienstraße", PostalCode: 69115}, true},
+		{"Kurfürsten-Anlage 1, 69115 Heidelberg", parken.Address{Street: "Kurfürsten-Anlage", PostalCode: 69115}, true},
+		{"Neckarstaden 2, 69117 Heidelberg", parken.Address{Street: "Neckarstaden", PostalCode: 69117}, true},
+		{"Im Neuenheimer Feld 130, 69120 Heidelberg", parken.Address{Street: "Im Neuenheimer Feld", PostalCode: 69120}, true},
+		{"Plöck 2, 69117 Heidelberg", parken.Address{Street: "Plöck", PostalCode: 69117}, true},
+		// Only words ending in "str." are abbreviations.
+		{"Am Kastr 3, 69117 Heidelberg", parken.Address{Street: "Am Kastraße", PostalCode: 69117}, false},
+		{"Poststraße 20, 69115 Heidelberg", parken.Address{Street: "Hauptstraße", PostalCode: 69115}, false},
+		{"Poststraße 20, 69115 Heidelberg", parken.Address{Street: "Poststraße", PostalCode: 69117}, false},
+		{"Poststraße 20, 69115 Heidelberg", parken.Address{}, true},
+	}
+	for _, test := range tests {
+		upstream, err := scraping.ParseAddress(test.upstream)
+		if err != nil {
+			t.Fatalf("ParseAddress(%q): %v", test.upstream, err)
+		}
+		if agree := addressesAgree(upstream, test.geocoded); agree != test.agree {
+			t.Errorf("addressesAgree(%q, %+v) = %t, want %t", test.upstream, test.geocoded, agree, test.agree)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultStaleIntervals is used if Server.StaleIntervals is 0.
+	defaultStaleIntervals = 3
+	pingTimeout           = 2 * time.Second
+)
+
+// scrapeStatus describes the outcome of the scrapes.
+type scrapeStatus struct {
+	last                time.Time
+	duration            time.Duration
+	err                 error
+	lastSuccess         time.Time
+	consecutiveFailures int
+}
+
+// recordScrape records the outcome of a scrape started at start.
+func (s *Server) recordScrape(start time.Time, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st := &s.scrapeStatus
+	st.last, st.duration, st.err = start, time.Since(start), err
+	if err != nil {
+		st.consecutiveFailures++
+	} else {
+		st.lastSuccess, st.consecutiveFailures = start, 0
+	}
+}
+
+// pingDB returns the state of the database, which is "disabled" if the server
+// has none.
+func (s *Server) pingDB(ctx context.Context) (string, error) {
+	s.dbMutex.Lock()
+	st := s.Store()
+	s.dbMutex.Unlock()
+	if st == nil {
+		return "disabled", nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	if err := st.Ping(ctx); err != nil {
+		return "unreachable", err
+	}
+	return "ok", nil
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// staleAfter returns the age after which data is stale, which is 0 if scraping
+// is not scheduled. The caller must hold s.mutex.
+func (s *Server) staleAfter() time.Duration {
+	n := s.StaleIntervals
+	if n == 0 {
+		n = defaultStaleIntervals
+	}
+	return time.Duration(n) * s.interval
+}
+
+// readyHandler reports whether the last successful scrape happened within the
+// last StaleIntervals scraping intervals and the database is reachable.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.RLock()
+	lastSuccess, staleAfter := s.scrapeStatus.lastSuccess, s.staleAfter()
+	s.mutex.RUnlock()
+	var problems []string
+	if lastSuccess.IsZero() || staleAfter != 0 && time.Since(lastSuccess) > staleAfter {
+		problems = append(problems, "data is stale")
+	}
+	if _, err := s.pingDB(r.Context()); err != nil {
+		problems = append(problems, "database is unreachable: "+err.Error())
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if len(problems) != 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, problem := range problems {
+			w.Write([]byte(problem + "\n"))
+		}
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+type statusResponse struct {
+	LastScrape          time.Time `json:"lastScrape"`
+	LastScrapeDuration  float64   `json:"lastScrapeDuration"`
+	LastScrapeError     string    `json:"lastScrapeError,omitempty"`
+	LastSuccess         time.Time `json:"lastSuccess"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	NextScrape          time.Time `json:"nextScrape"`
+	// Updated is the time of the upstream data and Age its age in seconds.
+	Updated       time.Time `json:"updated"`
+	Age           float64   `json:"age"`
+	Database      string    `json:"database"`
+	DatabaseError string    `json:"databaseError,omitempty"`
+	// GeocodingQueue counts the parkings waiting for geocoding, and
+	// GeocodingPending additionally the ones being geocoded.
+	GeocodingQueue   int `json:"geocodingQueue"`
+	GeocodingPending int `json:"geocodingPending"`
+}
+
+// statusHandler reports the state of scraping, the database and geocoding.
+// Durations are given in seconds.
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	res := statusResponse{}
+	var err error
+	res.Database, err = s.pingDB(r.Context())
+	if err != nil {
+		res.DatabaseError = err.Error()
+	}
+	s.mutex.RLock()
+	st := s.scrapeStatus
+	res.LastScrape, res.LastScrapeDuration = st.last, st.duration.Seconds()
+	if st.err != nil {
+		res.LastScrapeError = st.err.Error()
+	}
+	res.LastSuccess, res.ConsecutiveFailures = st.lastSuccess, st.consecutiveFailures
+	res.NextScrape, res.Updated = s.nextScrape, s.updated
+	res.GeocodingQueue, res.GeocodingPending = len(s.geocoding), len(s.pending)
+	s.mutex.RUnlock()
+	if !res.Updated.IsZero() {
+		res.Age = time.Since(res.Updated).Seconds()
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeJSON(w, res)
+}
@@ -0,0 +1,218 @@
+package web
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	_ "time/tzdata"
+)
+
+// location is used to determine the boundaries of days.
+var location, _ = time.LoadLocation("Europe/Berlin")
+
+type sample struct {
+	XMLName xml.Name  `json:"-" xml:"sample"`
+	Time    time.Time `json:"time" xml:"time,attr"`
+	Free    int       `json:"free" xml:"free,attr"`
+}
+
+type aggregate struct {
+	XMLName xml.Name  `json:"-" xml:"aggregate"`
+	Time    time.Time `json:"time" xml:"time,attr"`
+	Min     int       `json:"min" xml:"min,attr"`
+	Avg     float64   `json:"avg" xml:"avg,attr"`
+	Max     int       `json:"max" xml:"max,attr"`
+	Samples int       `json:"samples" xml:"samples,attr"`
+}
+
+// resolutions maps the supported resolutions of histories to functions that
+// return the start of the interval containing a time.
+var resolutions = map[string]func(time.Time) time.Time{
+	"raw":   nil,
+	"10min": func(t time.Time) time.Time { return t.Truncate(10 * time.Minute) },
+	"hour":  func(t time.Time) time.Time { return t.Truncate(time.Hour) },
+	"day": func(t time.Time) time.Time {
+		t = t.In(location)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location).UTC()
+	},
+}
+
+// maxSpans limits the range of histories per resolution, so that coarser
+// resolutions cover longer ranges.
+var maxSpans = map[string]time.Duration{
+	"raw":   7 * 24 * time.Hour,
+	"10min": 31 * 24 * time.Hour,
+	"hour":  366 * 24 * time.Hour,
+	"day":   10 * 366 * 24 * time.Hour,
+}
+
+var errParameter = errors.New("invalid parameter")
+
+// parseRange parses the from and to parameters, which default to the last 24
+// hours.
+func parseRange(r *http.Request) (from, to time.Time, err error) {
+	to = time.Now().UTC()
+	if v := r.FormValue("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, errParameter
+		}
+	}
+	from = to.Add(-24 * time.Hour)
+	if v := r.FormValue("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, errParameter
+		}
+	}
+	if !from.Before(to) {
+		return from, to, errParameter
+	}
+	return from.UTC(), to.UTC(), nil
+}
+
+var errNoDB = errors.New("no database")
+
+// querySpots returns the free spots of the given parkings between from
+// inclusive and to exclusive in chronological order. The spots of several
+// parkings are summed up per time.
+func (s *Server) querySpots(ids []int, from, to time.Time) ([]sample, error) {
+	s.dbMutex.Lock()
+	defer s.dbMutex.Unlock()
+	if s.Store() == nil {
+		return nil, errNoDB
+	}
+	stored, err := s.Store().History(ids, from, to)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]sample, len(stored))
+	for i, smpl := range stored {
+		samples[i] = sample{Time: smpl.Time, Free: smpl.Free}
+	}
+	return samples, nil
+}
+
+// aggregateSamples groups chronologically ordered samples into intervals.
+func aggregateSamples(samples []sample, truncate func(time.Time) time.Time) []aggregate {
+	var aggregates []aggregate
+	var sum int
+	for _, smpl := range samples {
+		start := truncate(smpl.Time)
+		if len(aggregates) == 0 || !aggregates[len(aggregates)-1].Time.Equal(start) {
+			aggregates = append(aggregates, aggregate{Time: start, Min: smpl.Free, Max: smpl.Free})
+			sum = 0
+		}
+		a := &aggregates[len(aggregates)-1]
+		if smpl.Free < a.Min {
+			a.Min = smpl.Free
+		}
+		if smpl.Free > a.Max {
+			a.Max = smpl.Free
+		}
+		sum += smpl.Free
+		a.Samples++
+		a.Avg = float64(sum) / float64(a.Samples)
+	}
+	return aggregates
+}
+
+// historyFormats are the formats of histories, the first of which is the
+// default.
+var historyFormats = []string{"json", "csv", "xml"}
+
+type historyResponse struct {
+	XMLName    xml.Name  `json:"-" xml:"history"`
+	ID         int       `json:"id" xml:"id,attr"`
+	Resolution string    `json:"resolution" xml:"resolution,attr"`
+	From       time.Time `json:"from" xml:"from,attr"`
+	To         time.Time `json:"to" xml:"to,attr"`
+	Samples    any       `json:"samples"`
+}
+
+func writeHistoryCSV(w http.ResponseWriter, samples []sample, aggregates []aggregate) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	if aggregates == nil {
+		cw.Write([]string{"time", "free"})
+		for _, smpl := range samples {
+			cw.Write([]string{smpl.Time.Format(time.RFC3339), strconv.Itoa(smpl.Free)})
+		}
+	} else {
+		cw.Write([]string{"time", "min", "avg", "max", "samples"})
+		for _, a := range aggregates {
+			cw.Write([]string{a.Time.Format(time.RFC3339), strconv.Itoa(a.Min),
+				strconv.FormatFloat(a.Avg, 'f', 2, 64), strconv.Itoa(a.Max), strconv.Itoa(a.Samples)})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// serveHistory serves the occupancy history of the given parkings, which
+// belong to the parking or zone with the given ID. The resolution is one of
+// raw, 10min, hour and day, which limit the range to 7 days, 31 days, 366 days
+// and 10 years respectively. Aggregated intervals contain the minimum, average
+// and maximum of free spots.
+func (s *Server) serveHistory(w http.ResponseWriter, r *http.Request, id int, parkingIDs []int) {
+	from, to, err := parseRange(r)
+	if err != nil {
+		httpError(w, http.StatusBadRequest)
+		return
+	}
+	resolution := r.FormValue("resolution")
+	if resolution == "" {
+		resolution = "raw"
+	}
+	truncate, ok := resolutions[resolution]
+	if !ok || to.Sub(from) > maxSpans[resolution] {
+		httpError(w, http.StatusBadRequest)
+		return
+	}
+	format, code := negotiateFormat(r, historyFormats)
+	if code != 0 {
+		httpError(w, code)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+
+	samples, err := s.querySpots(parkingIDs, from, to)
+	if err != nil {
+		if err == errNoDB {
+			httpError(w, http.StatusServiceUnavailable)
+			return
+		}
+		s.log().Error("querying spots", "error", err)
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+	var aggregates []aggregate
+	if truncate != nil {
+		aggregates = aggregateSamples(samples, truncate)
+		if aggregates == nil {
+			aggregates = []aggregate{}
+		}
+	} else if samples == nil {
+		samples = []sample{}
+	}
+
+	res := historyResponse{ID: id, Resolution: resolution, From: from, To: to, Samples: samples}
+	if truncate != nil {
+		res.Samples = aggregates
+	}
+	switch format {
+	case "csv":
+		if err := writeHistoryCSV(w, samples, aggregates); err != nil {
+			s.log().Error("writing history", "error", err)
+		}
+	case "xml":
+		w.Header().Set("Content-Type", contentTypes["xml"])
+		w.Write([]byte(xml.Header))
+		if err := xml.NewEncoder(w).Encode(res); err != nil {
+			s.log().Error("writing history", "error", err)
+		}
+	default:
+		s.writeJSON(w, res)
+	}
+}
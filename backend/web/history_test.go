@@ -0,0 +1,34 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/store"
+)
+
+func TestHistorySpan(t *testing.T) {
+	s := newTestServer(t, parken.Parking{ID: 1, Spots: 10})
+	s.SetStore(store.NewMemory())
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"from=2024-02-23T10:00:00Z&to=2024-03-01T10:00:00Z", http.StatusOK},
+		{"from=2024-02-23T09:59:59Z&to=2024-03-01T10:00:00Z", http.StatusBadRequest},
+		{"from=2024-02-01T10:00:00Z&to=2024-03-01T10:00:00Z&resolution=10min", http.StatusOK},
+		{"from=2024-01-01T10:00:00Z&to=2024-03-01T10:00:00Z&resolution=10min", http.StatusBadRequest},
+		{"from=2023-03-01T10:00:00Z&to=2024-03-01T10:00:00Z&resolution=hour", http.StatusOK},
+		{"from=2023-01-01T10:00:00Z&to=2024-03-01T10:00:00Z&resolution=hour", http.StatusBadRequest},
+		{"from=2015-01-01T10:00:00Z&to=2024-03-01T10:00:00Z&resolution=day", http.StatusOK},
+		{"from=2000-01-01T10:00:00Z&to=2024-03-01T10:00:00Z&resolution=day", http.StatusBadRequest},
+		{"from=2024-03-01T10:00:00Z&to=2024-03-01T10:00:00Z", http.StatusBadRequest},
+		{"resolution=week", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if w := serve(s.parkingHandler, "/api/parkings/1/history?"+test.query); w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.query, w.Code, test.status)
+		}
+	}
+}
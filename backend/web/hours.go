@@ -0,0 +1,88 @@
+package web
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+var (
+	weekdays = map[string]time.Weekday{"mo": time.Monday, "di": time.Tuesday, "mi": time.Wednesday,
+		"do": time.Thursday, "fr": time.Friday, "sa": time.Saturday, "so": time.Sunday}
+	// day matches the names of weekdays and their abbreviations, such as "Mo",
+	// "Mo." or "Montag", but not words merely starting like them, such as
+	// "frei" or "sonst".
+	day        = `(mo(?:ntags?)?|di(?:enstags?)?|mi(?:ttwochs?)?|do(?:nnerstags?)?|fr(?:eitags?)?|sa(?:mstags?)?|so(?:nntags?)?)(?:\.|\b)`
+	dayPattern = regexp.MustCompile(`(?i)\b` + day + `(?:\s*(?:-|–|bis)\s*` + day + `)?`)
+	// The minutes are optional, as in "7 - 20 Uhr".
+	timePattern   = regexp.MustCompile(`(\d{1,2})(?:[:.](\d{2}))?\s*(?:Uhr)?\s*(?:-|–|bis)\s*(\d{1,2})(?:[:.](\d{2}))?`)
+	allDayPattern = regexp.MustCompile(`(?i)24\s*(?:h|std|stunden)|rund um die uhr|durchgehend`)
+)
+
+func minutes(hours, mins string) int {
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(mins)
+	return h*60 + m
+}
+
+// lineDays returns the weekdays a line of opening hours applies to. Lines
+// without days apply to every day.
+func lineDays(line string) map[time.Weekday]bool {
+	days := make(map[time.Weekday]bool)
+	for _, match := range dayPattern.FindAllStringSubmatch(line, -1) {
+		from := weekdays[strings.ToLower(match[1][:2])]
+		to := from
+		if match[2] != "" {
+			to = weekdays[strings.ToLower(match[2][:2])]
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	if len(days) == 0 {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			days[d] = true
+		}
+	}
+	return days
+}
+
+// openAt reports whether the parking is open at the given time according to
+// its opening hours, which are free text such as "Mo-Fr 7:00-20:00 Uhr". The
+// second result is false if the opening hours could not be interpreted.
+func openAt(p *parken.Parking, t time.Time) (open, known bool) {
+	if p.OpenAllDay {
+		return true, true
+	}
+	t = t.In(location)
+	now := t.Hour()*60 + t.Minute()
+	for _, line := range strings.Split(p.OpeningHours, "\n") {
+		allDay := allDayPattern.MatchString(line)
+		ranges := timePattern.FindAllStringSubmatch(line, -1)
+		if !allDay && len(ranges) == 0 {
+			continue
+		}
+		known = true
+		if !lineDays(line)[t.Weekday()] {
+			continue
+		}
+		if allDay {
+			return true, true
+		}
+		for _, r := range ranges {
+			start, end := minutes(r[1], r[2]), minutes(r[3], r[4])
+			// Ranges past midnight are treated as open until the end of the
+			// day and from its start.
+			if start < end && now >= start && now < end || start >= end && (now >= start || now < end) {
+				return true, true
+			}
+		}
+	}
+	return false, known
+}
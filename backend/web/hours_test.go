@@ -0,0 +1,42 @@
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLineDays(t *testing.T) {
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	weekend := []time.Weekday{time.Saturday, time.Sunday}
+	every := append(append([]time.Weekday(nil), weekdays...), weekend...)
+	tests := []struct {
+		line string
+		days []time.Weekday
+	}{
+		{"Mo-Fr 7:00-20:00 Uhr", weekdays},
+		{"Mo. - Fr. 7.00 - 20.00 Uhr", weekdays},
+		{"Montag bis Freitag 7 - 20 Uhr", weekdays},
+		{"Sa, So 9:00-14:00", weekend},
+		{"samstags 8:00-18:00", []time.Weekday{time.Saturday}},
+		{"Do 7:00-22:00", []time.Weekday{time.Thursday}},
+		{"Fr-Mo 0:00-24:00", []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}},
+		{"0:00-24:00 frei zugänglich", every},
+		{"sonst 7:00-20:00", every},
+		{"Einfahrt mit Ticket 6:00-23:00", every},
+		{"Ausfahrt sowie Einfahrt 6:00-23:00", every},
+		{"Dauerparker 0:00-24:00", every},
+	}
+	for _, test := range tests {
+		days := lineDays(test.line)
+		if len(days) != len(test.days) {
+			t.Errorf("lineDays(%q) = %v, want %v", test.line, days, test.days)
+			continue
+		}
+		for _, d := range test.days {
+			if !days[d] {
+				t.Errorf("lineDays(%q) = %v, want %v", test.line, days, test.days)
+				break
+			}
+		}
+	}
+}
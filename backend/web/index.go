@@ -0,0 +1,180 @@
+package web
+
+import (
+	"math"
+	"sort"
+
+	"github.com/relseah/parken"
+)
+
+const (
+	geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+	// geohashPrecision yields cells of about 1.2 km by 0.6 km.
+	geohashPrecision = 6
+	// maxRings limits the search in rings. Queries far from every parking
+	// scan all cells instead.
+	maxRings = 32
+)
+
+// geohash encodes coordinates into a geohash with the given number of
+// characters.
+func geohash(c parken.Coordinates, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+	hash := make([]byte, 0, precision)
+	bit, ch := 0, 0
+	even := true
+	for len(hash) < precision {
+		if even {
+			mid := (minLon + maxLon) / 2
+			if c.Longitude >= mid {
+				ch |= 1 << (4 - bit)
+				minLon = mid
+			} else {
+				maxLon = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if c.Latitude >= mid {
+				ch |= 1 << (4 - bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+		} else {
+			hash = append(hash, geohashAlphabet[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// cellSize returns the height and width of geohash cells in degrees.
+func cellSize(precision int) (float64, float64) {
+	bits := precision * 5
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Exp2(float64(latBits)), 360 / math.Exp2(float64(lonBits))
+}
+
+// spatialIndex groups parkings by the geohash cell containing their
+// coordinates. Parkings without coordinates are not indexed.
+type spatialIndex struct {
+	cells                 map[string][]*parken.Parking
+	cellHeight, cellWidth float64
+	bounds                boundingBox
+}
+
+func newSpatialIndex(parkings []parken.Parking) *spatialIndex {
+	index := &spatialIndex{cells: make(map[string][]*parken.Parking)}
+	index.cellHeight, index.cellWidth = cellSize(geohashPrecision)
+	first := true
+	for i := range parkings {
+		p := &parkings[i]
+		if p.LocationPending || p.Coordinates == (parken.Coordinates{}) {
+			continue
+		}
+		hash := geohash(p.Coordinates, geohashPrecision)
+		index.cells[hash] = append(index.cells[hash], p)
+		if first {
+			index.bounds = boundingBox{min: p.Coordinates, max: p.Coordinates}
+			first = false
+			continue
+		}
+		index.bounds.min.Latitude = math.Min(index.bounds.min.Latitude, p.Coordinates.Latitude)
+		index.bounds.min.Longitude = math.Min(index.bounds.min.Longitude, p.Coordinates.Longitude)
+		index.bounds.max.Latitude = math.Max(index.bounds.max.Latitude, p.Coordinates.Latitude)
+		index.bounds.max.Longitude = math.Max(index.bounds.max.Longitude, p.Coordinates.Longitude)
+	}
+	return index
+}
+
+type neighbour struct {
+	parking  *parken.Parking
+	distance float64
+}
+
+// nearest returns up to k parkings with at least minFree free spots closest
+// to c, ordered by distance. The cells are searched in rings around the cell
+// containing c until no unsearched cell can contain a closer parking.
+func (index *spatialIndex) nearest(c parken.Coordinates, k, minFree int) []neighbour {
+	if len(index.cells) == 0 || k <= 0 {
+		return nil
+	}
+	// The number of rings needed to cover every indexed cell.
+	maxRing := int(math.Ceil(math.Max(
+		math.Max(math.Abs(c.Latitude-index.bounds.min.Latitude), math.Abs(c.Latitude-index.bounds.max.Latitude))/index.cellHeight,
+		math.Max(math.Abs(c.Longitude-index.bounds.min.Longitude), math.Abs(c.Longitude-index.bounds.max.Longitude))/index.cellWidth))) + 1
+	if maxRing > maxRings {
+		return index.scan(c, k, minFree)
+	}
+	// The minimum distance covered by each ring.
+	ringWidth := math.Min(index.cellHeight, index.cellWidth*math.Cos(radians(math.Min(89, math.Abs(c.Latitude))))) *
+		math.Pi / 180 * earthRadius
+
+	var candidates []neighbour
+	for ring := 0; ring <= maxRing; ring++ {
+		for i := -ring; i <= ring; i++ {
+			for j := -ring; j <= ring; j++ {
+				if max(abs(i), abs(j)) != ring {
+					continue
+				}
+				cell := parken.Coordinates{Latitude: c.Latitude + float64(i)*index.cellHeight,
+					Longitude: c.Longitude + float64(j)*index.cellWidth}
+				if cell.Latitude < -90 || cell.Latitude > 90 {
+					continue
+				}
+				for _, p := range index.cells[geohash(cell, geohashPrecision)] {
+					if p.Spots >= minFree {
+						candidates = append(candidates, neighbour{p, distance(c, p.Coordinates)})
+					}
+				}
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+		if len(candidates) >= k && candidates[k-1].distance <= float64(ring)*ringWidth {
+			break
+		}
+	}
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+func (index *spatialIndex) scan(c parken.Coordinates, k, minFree int) []neighbour {
+	var candidates []neighbour
+	for _, cell := range index.cells {
+		for _, p := range cell {
+			if p.Spots >= minFree {
+				candidates = append(candidates, neighbour{p, distance(c, p.Coordinates)})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// bearing returns the initial bearing from a to b in degrees clockwise from
+// north.
+func bearing(a, b parken.Coordinates) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLon := radians(b.Longitude - a.Longitude)
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
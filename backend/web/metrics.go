@@ -0,0 +1,185 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/nominatim"
+)
+
+type serverMetrics struct {
+	handler http.Handler
+
+	scrapes          *prometheus.CounterVec
+	scrapeDuration   *prometheus.HistogramVec
+	spots            *prometheus.GaugeVec
+	capacity         *prometheus.GaugeVec
+	dbInsertDuration *prometheus.HistogramVec
+	dbErrors         *prometheus.CounterVec
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+	rateLimited      *prometheus.CounterVec
+	apiKeyRequests   *prometheus.CounterVec
+	quotaExceeded    *prometheus.CounterVec
+}
+
+func (s *Server) newMetrics() {
+	r := prometheus.NewRegistry()
+	f := promauto.With(r)
+	m := &serverMetrics{handler: promhttp.HandlerFor(r, promhttp.HandlerOpts{})}
+	m.scrapes = f.NewCounterVec(prometheus.CounterOpts{Name: "parken_scrapes_total",
+		Help: "Scrapes by outcome (success, no_update or failure)."}, []string{"outcome"})
+	m.scrapeDuration = f.NewHistogramVec(prometheus.HistogramOpts{Name: "parken_scrape_duration_seconds",
+		Help: "Duration of scrapes."}, []string{"outcome"})
+	f.NewGaugeFunc(prometheus.GaugeOpts{Name: "parken_data_age_seconds", Help: "Age of the upstream data."}, func() float64 {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		if s.updated.IsZero() {
+			return 0
+		}
+		return time.Since(s.updated).Seconds()
+	})
+	m.spots = f.NewGaugeVec(prometheus.GaugeOpts{Name: "parken_parking_free_spots",
+		Help: "Free spots per parking."}, []string{"parking_id", "name"})
+	m.capacity = f.NewGaugeVec(prometheus.GaugeOpts{Name: "parken_parking_capacity",
+		Help: "Capacity per parking."}, []string{"parking_id", "name"})
+
+	stat := func(get func(nominatim.Stats) float64) func() float64 {
+		return func() float64 {
+			return get(s.Client.Stats())
+		}
+	}
+	f.NewCounterFunc(prometheus.CounterOpts{Name: "parken_geocoding_searches_total", Help: "Searches for coordinates."},
+		stat(func(st nominatim.Stats) float64 { return float64(st.Searches) }))
+	f.NewCounterFunc(prometheus.CounterOpts{Name: "parken_geocoding_reverse_searches_total", Help: "Reverse searches for addresses."},
+		stat(func(st nominatim.Stats) float64 { return float64(st.ReverseSearches) }))
+	f.NewCounterFunc(prometheus.CounterOpts{Name: "parken_geocoding_errors_total", Help: "Failed geocoding requests."},
+		stat(func(st nominatim.Stats) float64 { return float64(st.Errors) }))
+	f.NewCounterFunc(prometheus.CounterOpts{Name: "parken_geocoding_rate_limit_waits_total",
+		Help: "Geocoding requests delayed by the rate limit."},
+		stat(func(st nominatim.Stats) float64 { return float64(st.Waits) }))
+	f.NewCounterFunc(prometheus.CounterOpts{Name: "parken_geocoding_rate_limit_wait_seconds_total",
+		Help: "Total delay of geocoding requests by the rate limit."},
+		stat(func(st nominatim.Stats) float64 { return st.WaitTime.Seconds() }))
+	f.NewGaugeFunc(prometheus.GaugeOpts{Name: "parken_geocoding_queue_length",
+		Help: "Parkings waiting for or being geocoded."}, func() float64 {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		return float64(len(s.pending))
+	})
+
+	m.dbInsertDuration = f.NewHistogramVec(prometheus.HistogramOpts{Name: "parken_db_insert_duration_seconds",
+		Help: "Duration of inserts into the database."}, []string{"table"})
+	m.dbErrors = f.NewCounterVec(prometheus.CounterOpts{Name: "parken_db_errors_total",
+		Help: "Failed database operations."}, []string{"table"})
+	m.httpRequests = f.NewCounterVec(prometheus.CounterOpts{Name: "parken_http_requests_total",
+		Help: "HTTP requests by route, method and status code."}, []string{"route", "method", "code"})
+	m.httpDuration = f.NewHistogramVec(prometheus.HistogramOpts{Name: "parken_http_request_duration_seconds",
+		Help: "Duration of HTTP requests by route."}, []string{"route"})
+	m.rateLimited = f.NewCounterVec(prometheus.CounterOpts{Name: "parken_rate_limited_requests_total",
+		Help: "Requests rejected by the rate limit per client IP or API key."}, []string{"limit"})
+	f.NewGaugeFunc(prometheus.GaugeOpts{Name: "parken_rate_limited_ips", Help: "Client IPs tracked by the rate limit."}, func() float64 {
+		return float64(s.ipLimiter.len())
+	})
+	f.NewGaugeFunc(prometheus.GaugeOpts{Name: "parken_rate_limited_keys", Help: "API keys tracked by the rate limit."}, func() float64 {
+		return float64(s.keyLimiter.len())
+	})
+	m.apiKeyRequests = f.NewCounterVec(prometheus.CounterOpts{Name: "parken_api_key_requests_total",
+		Help: "Requests made with an API key by consumer and route."}, []string{"consumer", "route"})
+	m.quotaExceeded = f.NewCounterVec(prometheus.CounterOpts{Name: "parken_api_key_quota_exceeded_total",
+		Help: "Requests rejected by the daily quota of an API key."}, []string{"consumer"})
+	s.metrics = m
+}
+
+// methodLabel returns the method of a request as a label value. Methods other
+// than the standard ones are counted as OTHER to bound the number of series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// recordParkings replaces the gauges of the parkings.
+func (m *serverMetrics) recordParkings(parkings []parken.Parking) {
+	m.spots.Reset()
+	m.capacity.Reset()
+	for i := range parkings {
+		p := &parkings[i]
+		id := strconv.Itoa(p.ID)
+		m.spots.WithLabelValues(id, p.Name).Set(float64(p.Spots))
+		m.capacity.WithLabelValues(id, p.Name).Set(float64(p.Capacity))
+	}
+}
+
+// recordInsert records the duration and outcome of an insert into a table.
+func (m *serverMetrics) recordInsert(table string, start time.Time, err error) {
+	m.dbInsertDuration.WithLabelValues(table).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.dbErrors.WithLabelValues(table).Inc()
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrument counts the requests to a route and records their latencies,
+// except for long-lived streams. Each request is written to the access log.
+func (s *Server) instrument(route string, handler http.HandlerFunc, stream bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		handler(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		duration := time.Since(start)
+		s.metrics.httpRequests.WithLabelValues(route, methodLabel(r.Method), strconv.Itoa(recorder.status)).Inc()
+		if !stream {
+			s.metrics.httpDuration.WithLabelValues(route).Observe(duration.Seconds())
+		}
+		s.log().LogAttrs(r.Context(), slog.LevelInfo, "request", slog.String("method", r.Method),
+			slog.String("path", r.URL.Path), slog.String("route", route), slog.Int("status", recorder.status),
+			slog.Int("bytes", recorder.bytes), slog.Duration("duration", duration), slog.String("remote", r.RemoteAddr),
+			slog.String("client", s.clientIP(r).String()))
+	})
+}
@@ -0,0 +1,169 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// jsonFieldIndexes maps the types of structs to the indexes of their fields by
+// the names of their JSON members.
+var jsonFieldIndexes sync.Map
+
+// jsonFields returns the indexes of the fields of a struct by the names of
+// their JSON members, including the ones of embedded structs.
+func jsonFields(t reflect.Type) map[string][]int {
+	if fields, ok := jsonFieldIndexes.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	var add func(t reflect.Type, index []int)
+	add = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			fieldIndex := append(append([]int(nil), index...), i)
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				add(f.Type, fieldIndex)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if _, ok := fields[name]; !ok {
+				fields[name] = fieldIndex
+			}
+		}
+	}
+	add(t, nil)
+	jsonFieldIndexes.Store(t, fields)
+	return fields
+}
+
+// concrete dereferences pointers and interfaces. The result is invalid if the
+// Go type of the JSON is unknown, which is the case for nil interfaces and
+// types marshalling themselves.
+func concrete(source reflect.Value) reflect.Value {
+	for source.IsValid() {
+		t := source.Type()
+		if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+			return reflect.Value{}
+		}
+		switch {
+		case t.Kind() == reflect.Interface && source.IsNil():
+			return reflect.Value{}
+		case t.Kind() == reflect.Pointer && source.IsNil():
+			// The type is still known from a nil pointer.
+			source = reflect.Zero(t.Elem())
+		case t.Kind() == reflect.Interface || t.Kind() == reflect.Pointer:
+			source = source.Elem()
+		default:
+			return source
+		}
+	}
+	return source
+}
+
+// element returns the source of the ith of n elements of an array. The
+// elements of the source are used only if their number matches, since arrays
+// may have been filtered or sorted, and otherwise their type.
+func element(source reflect.Value, i, n int) reflect.Value {
+	if source.Kind() != reflect.Slice && source.Kind() != reflect.Array {
+		return reflect.Value{}
+	}
+	if source.Len() == n {
+		return source.Index(i)
+	}
+	return reflect.Zero(source.Type().Elem())
+}
+
+// member returns the source of a member of an object.
+func member(source reflect.Value, key string) reflect.Value {
+	switch source.Kind() {
+	case reflect.Struct:
+		index, ok := jsonFields(source.Type())[key]
+		if !ok {
+			return reflect.Value{}
+		}
+		if f, err := source.FieldByIndexErr(index); err == nil {
+			return f
+		}
+		return reflect.Zero(source.Type().FieldByIndex(index).Type)
+	case reflect.Map:
+		if source.Type().Key().Kind() == reflect.String {
+			if v := source.MapIndex(reflect.ValueOf(key).Convert(source.Type().Key())); v.IsValid() {
+				return v
+			}
+		}
+		return reflect.Zero(source.Type().Elem())
+	}
+	return reflect.Value{}
+}
+
+// typeNumbers converts the numbers of a value decoded from JSON with numbers
+// preserved as json.Number for encoding it as MessagePack. Numbers are typed by
+// the Go type of the corresponding part of source, the value the JSON was
+// marshalled from, so that floats remain floats even if they are integral.
+// Numbers of an unknown type, such as members added to the JSON, are integers
+// if they are integral. Arrays and objects are converted in place.
+func typeNumbers(v any, source reflect.Value) (any, error) {
+	source = concrete(source)
+	switch v := v.(type) {
+	case json.Number:
+		switch source.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return v.Float64()
+		}
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case []any:
+		for i, e := range v {
+			typed, err := typeNumbers(e, element(source, i, len(v)))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = typed
+		}
+	case map[string]any:
+		for key, m := range v {
+			typed, err := typeNumbers(m, member(source, key))
+			if err != nil {
+				return nil, err
+			}
+			v[key] = typed
+		}
+	}
+	return v, nil
+}
+
+// encodeMsgpack encodes a value decoded from JSON as MessagePack, typing its
+// numbers by source. Integers take the smallest format and keys of maps are
+// sorted, so that the encoding is deterministic.
+func encodeMsgpack(v any, source reflect.Value) ([]byte, error) {
+	v, err := typeNumbers(v, source)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	enc := msgpack.NewEncoder(&b)
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/relseah/parken"
+)
+
+// roundTrip encodes the JSON of v as MessagePack and decodes it with the
+// reference implementation.
+func roundTrip(t *testing.T, v any, compact bool) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := represent(data, "msgpack", compact, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded any
+	if err := msgpack.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("decoding %x: %v", encoded, err)
+	}
+	return decoded
+}
+
+// kind describes a decoded value by its type and value.
+func kind(v any) string {
+	switch v.(type) {
+	case float32, float64:
+		return fmt.Sprintf("float %v", v)
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("int %v", v)
+	}
+	return fmt.Sprintf("%T %v", v, v)
+}
+
+func TestMsgpack(t *testing.T) {
+	type inner struct {
+		X float64 `json:"x"`
+	}
+	type document struct {
+		Latitude  float64           `json:"latitude"`
+		Spots     int               `json:"spots"`
+		Ratio     *float64          `json:"ratio"`
+		Inner     *inner            `json:"inner"`
+		Website   parken.URL        `json:"website"`
+		Updated   time.Time         `json:"updated"`
+		Values    []float64         `json:"values"`
+		Named     map[string]inner  `json:"named"`
+		Anything  any               `json:"anything"`
+		Annotated map[string]string `json:"annotated,omitempty"`
+	}
+	ratio := 2.0
+	u, _ := url.Parse("https://example.org/parken")
+	v := document{Latitude: 49, Spots: 7, Ratio: &ratio, Website: parken.URL{URL: u}, Updated: testUpdated,
+		Values: []float64{1, 2.5}, Named: map[string]inner{"a": {3}}, Anything: 4}
+	decoded := roundTrip(t, v, false).(map[string]any)
+	tests := []struct {
+		name string
+		got  any
+		want string
+	}{
+		{"integral float", decoded["latitude"], "float 49"},
+		{"integer", decoded["spots"], "int 7"},
+		{"pointer to float", decoded["ratio"], "float 2"},
+		{"nil pointer", decoded["inner"], "<nil> <nil>"},
+		{"type marshalling itself", decoded["website"], "string https://example.org/parken"},
+		{"time", decoded["updated"], "string 2024-03-01T10:00:00Z"},
+		{"float in array", decoded["values"].([]any)[0], "float 1"},
+		{"float in map", decoded["named"].(map[string]any)["a"].(map[string]any)["x"], "float 3"},
+		{"number of unknown type", decoded["anything"], "int 4"},
+	}
+	for _, test := range tests {
+		if got := kind(test.got); got != test.want {
+			t.Errorf("%s: %s, want %s", test.name, got, test.want)
+		}
+	}
+
+	// Zero values and empty objects are left out in compact mode.
+	v = document{Inner: &inner{}, Updated: testUpdated}
+	compacted := roundTrip(t, v, true).(map[string]any)
+	if len(compacted) != 1 || kind(compacted["updated"]) != "string 2024-03-01T10:00:00Z" {
+		t.Errorf("compact document = %v", compacted)
+	}
+}
+
+// TestMsgpackFiltered checks that the elements of arrays whose length differs
+// from the source, e.g. because they were filtered, are typed by the type of
+// the elements of the source.
+func TestMsgpackFiltered(t *testing.T) {
+	source := []float64{1, 2, 3}
+	data, err := represent([]byte(`[1, 3]`), "msgpack", false, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []any
+	if err := msgpack.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || kind(decoded[0]) != "float 1" || kind(decoded[1]) != "float 3" {
+		t.Errorf("filtered array = %v", decoded)
+	}
+}
+
+// TestMsgpackLengths checks the headers of arrays, maps and strings around
+// the limits of their formats.
+func TestMsgpackLengths(t *testing.T) {
+	for _, n := range []int{15, 16, 31, 32, 255, 256, 65535, 65536} {
+		array := make([]int, n)
+		object := make(map[string]int, n)
+		for i := range array {
+			array[i] = i
+			object[fmt.Sprint(i)] = i
+		}
+		v := map[string]any{"array": array, "object": object, "string": string(make([]byte, n))}
+		decoded := roundTrip(t, v, false).(map[string]any)
+		if len(decoded["array"].([]any)) != n || len(decoded["object"].(map[string]any)) != n ||
+			len(decoded["string"].(string)) != n {
+			t.Errorf("%d entries: decoded %d, %d and %d", n, len(decoded["array"].([]any)),
+				len(decoded["object"].(map[string]any)), len(decoded["string"].(string)))
+			continue
+		}
+		if last := decoded["array"].([]any)[n-1]; kind(last) != fmt.Sprintf("int %d", n-1) {
+			t.Errorf("%d entries: last element %s", n, kind(last))
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package web
+
+//go:generate go run -tags openapigen ./openapigen 1 openapi.json
+//go:generate go run -tags openapigen ./openapigen 2 openapi-v2.json
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/scraping"
+)
+
+// schemaNames names the types that are described as components of the
+// specification.
+var schemaNames = map[reflect.Type]string{
+	reflect.TypeOf(parken.Address{}):     "Address",
+	reflect.TypeOf(parken.Coordinates{}): "Coordinates",
+	reflect.TypeOf(parken.Parking{}):     "Parking",
+	reflect.TypeOf(scraping.Result{}):    "Parkings",
+	reflect.TypeOf(parkingResponse{}):    "ParkingDetails",
+	reflect.TypeOf(parkingLinks{}):       "Links",
+	reflect.TypeOf(nearestParking{}):     "NearestParking",
+	reflect.TypeOf(nearestResponse{}):    "NearestParkings",
+	reflect.TypeOf(zoneTotals{}):         "ZoneTotals",
+	reflect.TypeOf(zonesResponse{}):      "Zones",
+	reflect.TypeOf(zoneResponse{}):       "ZoneDetails",
+	reflect.TypeOf(historyResponse{}):    "History",
+	reflect.TypeOf(sample{}):             "Sample",
+	reflect.TypeOf(aggregate{}):          "Aggregate",
+	reflect.TypeOf(delta{}):              "Delta",
+	reflect.TypeOf(changesResponse{}):    "Changes",
+}
+
+// interfaceFields lists the types of the values of fields with an interface
+// type.
+var interfaceFields = map[string][]reflect.Type{
+	"historyResponse.Samples": {reflect.TypeOf([]sample{}), reflect.TypeOf([]aggregate{})},
+}
+
+type object = map[string]any
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaGenerator derives JSON schemas from Go types the way encoding/json
+// serialises them. In compact mode, no member is required, as empty and zero
+// values are left out.
+type schemaGenerator struct {
+	schemas object
+	compact bool
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) object {
+	if name, ok := schemaNames[t]; ok {
+		if _, ok := g.schemas[name]; !ok {
+			// The placeholder ends recursion.
+			g.schemas[name] = nil
+			g.schemas[name] = g.structSchema(t)
+		}
+		return ref(name)
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return object{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(parken.URL{}):
+		return object{"type": "string", "format": "uri", "nullable": true}
+	case reflect.TypeOf(json.RawMessage{}):
+		return object{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Pointer:
+		schema := g.schema(t.Elem())
+		if _, ok := schema["$ref"]; ok {
+			return object{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+	return object{}
+}
+
+// fields adds the properties of the fields of the struct, including the ones
+// of embedded structs, and reports the names of the required ones.
+func (g *schemaGenerator) fields(t reflect.Type, properties object, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, properties, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if types, ok := interfaceFields[t.Name()+"."+f.Name]; ok {
+			oneOf := make([]any, len(types))
+			for i, t := range types {
+				oneOf[i] = g.schema(t)
+			}
+			properties[name] = object{"oneOf": oneOf}
+		} else {
+			properties[name] = g.schema(f.Type)
+		}
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) object {
+	properties := object{}
+	var required []string
+	g.fields(t, properties, &required)
+	schema := object{"type": "object", "properties": properties}
+	if required != nil && !g.compact {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func parameter(name, in, description string, schema object) object {
+	p := object{"name": name, "in": in, "description": description, "schema": schema}
+	if in == "path" {
+		p["required"] = true
+	}
+	return p
+}
+
+var (
+	stringSchema  = object{"type": "string"}
+	integerSchema = object{"type": "integer"}
+	numberSchema  = object{"type": "number"}
+	booleanSchema = object{"type": "boolean"}
+)
+
+func errorResponse(description string) object {
+	return object{"description": description, "content": object{"text/plain": object{"schema": stringSchema}}}
+}
+
+func operation(summary string, parameters []any, content object) object {
+	responses := object{
+		"200": object{"description": "OK", "content": content},
+		"400": errorResponse("Invalid parameters"),
+		"401": object{
+			"description": "Unknown API key",
+			"headers": object{"WWW-Authenticate": object{
+				"description": "The header the API key is expected in",
+				"schema":      stringSchema,
+			}},
+			"content": object{"text/plain": object{"schema": stringSchema}},
+		},
+		"429": object{
+			"description": "Rate limit or quota exceeded",
+			"headers": object{"Retry-After": object{
+				"description": "Seconds until the next request is allowed",
+				"schema":      integerSchema,
+			}},
+			"content": object{"text/plain": object{"schema": stringSchema}},
+		},
+	}
+	op := object{"summary": summary, "responses": responses}
+	if parameters != nil {
+		op["parameters"] = parameters
+	}
+	return object{"get": op}
+}
+
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+// apiContent describes a resource that is also available as MessagePack.
+func apiContent(schema object) object {
+	content := jsonContent(schema)
+	content["application/msgpack"] = object{"schema": schema}
+	return content
+}
+
+// OpenAPI generates the OpenAPI specification of the given version of the API,
+// either 1 or 2.
+func OpenAPI(version int) ([]byte, error) {
+	var prefix, description, compactDefault string
+	switch version {
+	case 1:
+		prefix, compactDefault = apiPrefix, "false"
+		description = "Occupancy of the parkings in Heidelberg. The routes are also served without the version prefix, where they follow version 1. " +
+			"Version 2 serves the same routes in compact mode and is described by " + apiV2Prefix + "/openapi.json."
+	case 2:
+		prefix, compactDefault = apiV2Prefix, "true"
+		description = "Occupancy of the parkings in Heidelberg. Empty and zero values are left out unless compact is false, " +
+			"so that no member is required and absent members have their zero value."
+	default:
+		return nil, fmt.Errorf("unknown version %d", version)
+	}
+	g := &schemaGenerator{schemas: object{}, compact: version == 2}
+	id := parameter("id", "path", "ID of the parking", integerSchema)
+	zoneID := parameter("id", "path", "ID of the zone", integerSchema)
+	history := []any{
+		parameter("from", "query", "Start of the range in RFC 3339 format, by default 24 hours before its end", object{"type": "string", "format": "date-time"}),
+		parameter("to", "query", "End of the range in RFC 3339 format, by default now", object{"type": "string", "format": "date-time"}),
+		parameter("resolution", "query", "Resolution of the history, which limits the range to 7 days for raw, 31 days for 10min, 366 days for hour and 10 years for day", object{"type": "string", "enum": []string{"raw", "10min", "hour", "day"}}),
+		parameter("format", "query", "Format of the response, which takes precedence over the Accept header", object{"type": "string", "enum": historyFormats}),
+	}
+	historyContent := jsonContent(g.schema(reflect.TypeOf(historyResponse{})))
+	historyContent["text/csv"] = object{"schema": stringSchema}
+	historyContent["application/xml"] = object{"schema": stringSchema}
+	parkingsContent := apiContent(g.schema(reflect.TypeOf(scraping.Result{})))
+	parkingsContent["text/csv"] = object{"schema": stringSchema}
+	parkingsContent["application/geo+json"] = object{"schema": object{"type": "object"}}
+	parkingsContent["application/xml"] = object{"schema": stringSchema}
+	compact := parameter("compact", "query", "Whether empty and zero values are left out, by default "+compactDefault+
+		". Left out members have their zero value, even if they are required.", booleanSchema)
+	notFound := errorResponse("Not found")
+	noDB := errorResponse("History is not available")
+
+	paths := object{
+		"/parkings": operation("Current occupancy of all parkings", []any{
+			parameter("zone", "query", "Comma-separated IDs of zones", stringSchema),
+			parameter("operator", "query", "Operator, compared case-insensitively", stringSchema),
+			parameter("minFree", "query", "Minimum number of free spots", integerSchema),
+			parameter("open", "query", "Whether the parking is open now", booleanSchema),
+			parameter("charging", "query", "Whether the parking has charging stations", booleanSchema),
+			parameter("bbox", "query", "Bounding box as minLon,minLat,maxLon,maxLat", stringSchema),
+			parameter("near", "query", "Coordinates as lat,lon, which add the distance in meters to each parking", stringSchema),
+			parameter("radius", "query", "Maximum distance from near in meters", numberSchema),
+			parameter("sort", "query", "Order of the parkings", object{"type": "string", "enum": []string{"free", "distance", "name"}}),
+			parameter("fields", "query", "Comma-separated fields of the parkings to include", stringSchema),
+			parameter("format", "query", "Format of the response, which takes precedence over the Accept header", object{"type": "string", "enum": parkingFormats}),
+			parameter("at", "query", "Time in RFC 3339 format of a past snapshot, which is reconstructed from the history. Its parkings have the time of their sample in sampled and whether it is stale in stale.", object{"type": "string", "format": "date-time"}),
+		}, parkingsContent),
+		"/parkings/nearest": operation("Parkings closest to the given coordinates", []any{
+			object{"name": "lat", "in": "query", "required": true, "schema": numberSchema},
+			object{"name": "lon", "in": "query", "required": true, "schema": numberSchema},
+			parameter("k", "query", "Number of parkings, at most 100", object{"type": "integer", "default": defaultNearest}),
+			parameter("minFree", "query", "Minimum number of free spots", integerSchema),
+		}, apiContent(g.schema(reflect.TypeOf(nearestResponse{})))),
+		"/parkings/changes": operation("Parkings changed since a previous snapshot", []any{
+			object{"name": "version", "in": "query", "description": "Version of the previous snapshot as returned by the previous request", "schema": integerSchema},
+			object{"name": "since", "in": "query", "description": "Time the previous snapshot was updated in RFC 3339 format, used if no version is given", "schema": object{"type": "string", "format": "date-time"}},
+		}, apiContent(g.schema(reflect.TypeOf(changesResponse{})))),
+		"/parkings/{id}":         operation("Current occupancy of a parking", []any{id}, apiContent(g.schema(reflect.TypeOf(parkingResponse{})))),
+		"/parkings/{id}/history": operation("Occupancy history of a parking", append([]any{id}, history...), historyContent),
+		"/zones":                 operation("Current occupancy of all zones and the city", nil, apiContent(g.schema(reflect.TypeOf(zonesResponse{})))),
+		"/zones/{id}":            operation("Current occupancy of a zone", []any{zoneID}, apiContent(g.schema(reflect.TypeOf(zoneResponse{})))),
+		"/zones/{id}/history":    operation("Summed up occupancy history of the parkings of a zone", append([]any{zoneID}, history...), historyContent),
+		"/stream": operation("Server-sent events with a snapshot of all parkings followed by deltas", nil, object{
+			"text/event-stream": object{"schema": stringSchema},
+		}),
+	}
+	g.schema(reflect.TypeOf(delta{}))
+	for path, item := range paths {
+		op := item.(object)["get"].(object)
+		responses := op["responses"].(object)
+		if path == "/stream" {
+			op["parameters"] = []any{compact}
+		}
+		if _, ok := responses["200"].(object)["content"].(object)["application/msgpack"]; ok {
+			parameters, _ := op["parameters"].([]any)
+			if path != "/parkings" {
+				parameters = append(parameters, parameter("format", "query", "Format of the response, which takes precedence over the Accept header", object{"type": "string", "enum": apiFormats}))
+			}
+			op["parameters"] = append(parameters, compact)
+		}
+		if strings.Contains(path, "{id}") {
+			responses["404"] = notFound
+		}
+		if strings.HasSuffix(path, "/history") || path == "/parkings" {
+			responses["503"] = noDB
+		}
+	}
+
+	doc := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "Parken",
+			"version":     strings.TrimPrefix(prefix, "/api/"),
+			"description": description,
+		},
+		"servers": []any{object{"url": prefix}},
+		"paths":   paths,
+		"components": object{
+			"schemas": g.schemas,
+			"securitySchemes": object{
+				"apiKey": object{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		// API keys are optional.
+		"security": []any{object{}, object{"apiKey": []string{}}},
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func openAPIHandler(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(spec)
+	}
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPI fails if the types of the API drifted from the published
+// specifications.
+func TestOpenAPI(t *testing.T) {
+	for version, published := range map[int][]byte{1: publishedOpenAPI, 2: publishedOpenAPIV2} {
+		generated, err := OpenAPI(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if differences := compareOpenAPI(generated, published); differences != "" {
+			t.Errorf("API version %d differs from published specification in %s; run go generate in package web after a deliberate change",
+				version, differences)
+		}
+	}
+}
+
+// compareOpenAPI describes how a generated specification differs from the
+// published one, naming the drifted schemas.
+func compareOpenAPI(generated, publishedSpec []byte) string {
+	if bytes.Equal(generated, publishedSpec) {
+		return ""
+	}
+	var published, current struct {
+		Components struct {
+			Schemas map[string]any
+		}
+	}
+	if err := json.Unmarshal(publishedSpec, &published); err != nil {
+		return "its syntax: " + err.Error()
+	}
+	if err := json.Unmarshal(generated, &current); err != nil {
+		return "its syntax: " + err.Error()
+	}
+	var drifted []string
+	for name, schema := range current.Components.Schemas {
+		if !reflect.DeepEqual(schema, published.Components.Schemas[name]) {
+			drifted = append(drifted, name)
+		}
+	}
+	for name := range published.Components.Schemas {
+		if _, ok := current.Components.Schemas[name]; !ok {
+			drifted = append(drifted, name)
+		}
+	}
+	sort.Strings(drifted)
+	if drifted != nil {
+		return "schemas " + strings.Join(drifted, ", ")
+	}
+	return "paths"
+}
@@ -0,0 +1,31 @@
+// Openapigen writes the OpenAPI specification of a version of the API, which
+// is generated from its types, to a file. It is run by go generate in package web
+// with the build tag openapigen, which keeps the package from embedding the
+// specification being written.
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/relseah/parken/web"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) != 3 {
+		log.Fatalln("usage: openapigen <version> <file>")
+	}
+	version, err := strconv.Atoi(os.Args[1])
+	if err != nil {
+		log.Fatalln("invalid version:", os.Args[1])
+	}
+	spec, err := web.OpenAPI(version)
+	if err != nil {
+		log.Fatalln("generating OpenAPI specification:", err)
+	}
+	if err := os.WriteFile(os.Args[2], spec, 0644); err != nil {
+		log.Fatalln("writing OpenAPI specification:", err)
+	}
+}
@@ -0,0 +1,218 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/store"
+)
+
+// override replaces the coordinates and metadata of a parking. Fields that are
+// nil are taken from upstream.
+type override struct {
+	Coordinates *parken.Coordinates `json:"coordinates,omitempty"`
+	Name        *string             `json:"name,omitempty"`
+	PhoneNumber *string             `json:"phoneNumber,omitempty"`
+	Website     *string             `json:"website,omitempty"`
+	Notes       *string             `json:"notes,omitempty"`
+	Updated     time.Time           `json:"updated"`
+	UpdatedBy   string              `json:"updatedBy"`
+}
+
+func (o override) validate() error {
+	if o.Coordinates == nil && o.Name == nil && o.PhoneNumber == nil && o.Website == nil && o.Notes == nil {
+		return errors.New("empty override")
+	}
+	if c := o.Coordinates; c != nil && (c.Latitude < -90 || c.Latitude > 90 || c.Longitude < -180 || c.Longitude > 180) {
+		return errors.New("coordinates out of range")
+	}
+	if o.Website != nil && *o.Website != "" {
+		u, err := url.Parse(*o.Website)
+		if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return errors.New("invalid website")
+		}
+	}
+	return nil
+}
+
+// apply replaces the metadata of the parking. The coordinates are applied by
+// locate.
+func (o override) apply(p *parken.Parking) {
+	if o.Name != nil {
+		p.Name = *o.Name
+	}
+	if o.PhoneNumber != nil {
+		p.PhoneNumber = *o.PhoneNumber
+	}
+	if o.Website != nil {
+		// The website has been validated.
+		u, _ := url.Parse(*o.Website)
+		if *o.Website == "" {
+			u = nil
+		}
+		p.Website = parken.URL{URL: u}
+	}
+	if o.Notes != nil {
+		p.Notes = *o.Notes
+	}
+}
+
+// queryOverrides reads the overrides from the store.
+func (s *Server) queryOverrides() (map[int]override, error) {
+	s.dbMutex.Lock()
+	defer s.dbMutex.Unlock()
+	stored, err := s.Store().Overrides()
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[int]override, len(stored))
+	for id, o := range stored {
+		overrides[id] = override(o)
+	}
+	return overrides, nil
+}
+
+// setOverride stores the override and applies it to the current snapshot.
+func (s *Server) setOverride(id int, o override, actor string) error {
+	s.adminMutex.Lock()
+	defer s.adminMutex.Unlock()
+	details, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	err = s.record(auditEntry{Actor: actor, Action: "set_override", ParkingID: id, Details: details}, func(st store.Store, entry store.AuditEntry) error {
+		return st.SetOverride(id, store.Override(o), entry)
+	})
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// The address is looked up again if the coordinates change.
+	old := s.overrides[id]
+	if (old.Coordinates == nil) != (o.Coordinates == nil) || old.Coordinates != nil && *old.Coordinates != *o.Coordinates {
+		delete(s.addresses, id)
+	}
+	s.overrides[id] = o
+	return s.refresh()
+}
+
+// deleteOverride deletes the override and reverts the parking to its upstream
+// data in the current snapshot.
+func (s *Server) deleteOverride(id int, actor string) error {
+	s.adminMutex.Lock()
+	defer s.adminMutex.Unlock()
+	s.mutex.RLock()
+	o, ok := s.overrides[id]
+	s.mutex.RUnlock()
+	if !ok {
+		return errNotFound
+	}
+	details, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	err = s.record(auditEntry{Actor: actor, Action: "delete_override", ParkingID: id, Details: details}, func(st store.Store, entry store.AuditEntry) error {
+		return st.DeleteOverride(id, entry)
+	})
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if o.Coordinates != nil {
+		delete(s.addresses, id)
+	}
+	delete(s.overrides, id)
+	return s.refresh()
+}
+
+var errNotFound = errors.New("not found")
+
+type overrideResponse struct {
+	ParkingID int `json:"parkingId"`
+	override
+}
+
+// overridesHandler lists the overrides ordered by the ID of their parking.
+func (s *Server) overridesHandler(w http.ResponseWriter, r *http.Request, actor string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	s.mutex.RLock()
+	res := make([]overrideResponse, 0, len(s.overrides))
+	for id, o := range s.overrides {
+		res = append(res, overrideResponse{id, o})
+	}
+	s.mutex.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ParkingID < res[j].ParkingID
+	})
+	s.writeJSON(w, res)
+}
+
+// overrideHandler gets, sets and deletes the override of a parking at
+// /admin/overrides/{id}. Only parkings of the current snapshot can be
+// overridden.
+func (s *Server) overrideHandler(w http.ResponseWriter, r *http.Request, actor string) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/admin/overrides/"))
+	if err != nil {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.mutex.RLock()
+		o, ok := s.overrides[id]
+		s.mutex.RUnlock()
+		if !ok {
+			httpError(w, http.StatusNotFound)
+			return
+		}
+		s.writeJSON(w, overrideResponse{id, o})
+	case http.MethodPut:
+		if _, ok := s.lookupParking(id); !ok {
+			httpError(w, http.StatusNotFound)
+			return
+		}
+		var o override
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminBody))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&o); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := o.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		o.Updated, o.UpdatedBy = time.Now().UTC().Truncate(time.Second), actor
+		if err := s.setOverride(id, o, actor); err != nil {
+			s.log().Error("setting override", "parking_id", id, "error", err)
+			httpError(w, http.StatusInternalServerError)
+			return
+		}
+		s.writeJSON(w, overrideResponse{id, o})
+	case http.MethodDelete:
+		if err := s.deleteOverride(id, actor); err != nil {
+			if err == errNotFound {
+				httpError(w, http.StatusNotFound)
+				return
+			}
+			s.log().Error("deleting override", "parking_id", id, "error", err)
+			httpError(w, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
@@ -0,0 +1,157 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+type parkingLinks struct {
+	Self     string `json:"self"`
+	History  string `json:"history"`
+	Forecast string `json:"forecast,omitempty"`
+}
+
+type parkingResponse struct {
+	parken.Parking
+	ZoneName string `json:"zoneName"`
+	// Occupancy is the fraction of occupied spots.
+	Occupancy float64      `json:"occupancy"`
+	Updated   time.Time    `json:"updated"`
+	Links     parkingLinks `json:"links"`
+}
+
+func occupancy(spots, capacity int) float64 {
+	if capacity == 0 {
+		return 0
+	}
+	return float64(capacity-spots) / float64(capacity)
+}
+
+// lookupParking returns the parking with the given ID from the current
+// snapshot.
+func (s *Server) lookupParking(id int) (parken.Parking, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, p := range s.parkings {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return parken.Parking{}, false
+}
+
+// forecastURL links to the forecast of the current day, since the general
+// forecast of the prediction service requires a range.
+func (s *Server) forecastURL(id int) string {
+	if s.PredictionURL == nil {
+		return ""
+	}
+	u := *s.PredictionURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/prediction-today"
+	u.RawQuery = url.Values{"id": {strconv.Itoa(id)}}.Encode()
+	return u.String()
+}
+
+const (
+	defaultNearest = 5
+	maxNearest     = 100
+)
+
+type nearestParking struct {
+	parken.Parking
+	// Distance is the great-circle distance in meters.
+	Distance float64 `json:"distance"`
+	// Bearing is given in degrees clockwise from north.
+	Bearing float64 `json:"bearing"`
+}
+
+type nearestResponse struct {
+	Updated  time.Time        `json:"updated"`
+	Parkings []nearestParking `json:"parkings"`
+}
+
+// nearestHandler serves the k parkings closest to the given coordinates with
+// at least minFree free spots.
+func (s *Server) nearestHandler(w http.ResponseWriter, r *http.Request) {
+	latitude, err := strconv.ParseFloat(r.FormValue("lat"), 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		httpError(w, http.StatusBadRequest)
+		return
+	}
+	longitude, err := strconv.ParseFloat(r.FormValue("lon"), 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		httpError(w, http.StatusBadRequest)
+		return
+	}
+	k := defaultNearest
+	if v := r.FormValue("k"); v != "" {
+		if k, err = strconv.Atoi(v); err != nil || k < 1 || k > maxNearest {
+			httpError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	var minFree int
+	if v := r.FormValue("minFree"); v != "" {
+		if minFree, err = strconv.Atoi(v); err != nil {
+			httpError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	c := parken.Coordinates{Latitude: latitude, Longitude: longitude}
+	s.mutex.RLock()
+	index, updated := s.index, s.updated
+	s.mutex.RUnlock()
+	neighbours := index.nearest(c, k, minFree)
+	parkings := make([]nearestParking, len(neighbours))
+	for i, n := range neighbours {
+		parkings[i] = nearestParking{Parking: *n.parking, Distance: n.distance, Bearing: bearing(c, n.parking.Coordinates)}
+	}
+	s.writeAPI(w, r, nearestResponse{updated, parkings})
+}
+
+// parkingHandler serves the resources below /api/parkings/ and
+// /api/v1/parkings/.
+func (s *Server) parkingHandler(w http.ResponseWriter, r *http.Request) {
+	prefix, path := apiPath(r)
+	segments := strings.Split(strings.TrimPrefix(path, "/parkings/"), "/")
+	if len(segments) == 1 && segments[0] == "nearest" {
+		s.nearestHandler(w, r)
+		return
+	}
+	if len(segments) == 1 && segments[0] == "changes" {
+		s.changesHandler(w, r)
+		return
+	}
+	id, err := strconv.Atoi(segments[0])
+	if err != nil || len(segments) > 2 {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+	p, ok := s.lookupParking(id)
+	if !ok {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+	if len(segments) == 2 {
+		if segments[1] != "history" {
+			httpError(w, http.StatusNotFound)
+			return
+		}
+		s.serveHistory(w, r, id, []int{id})
+		return
+	}
+
+	s.mutex.RLock()
+	res := parkingResponse{Parking: p, ZoneName: s.zones[p.Zone], Occupancy: occupancy(p.Spots, p.Capacity), Updated: s.updated}
+	s.mutex.RUnlock()
+	self := fmt.Sprintf("%s/parkings/%d", prefix, p.ID)
+	res.Links = parkingLinks{Self: self, History: self + "/history", Forecast: s.forecastURL(p.ID)}
+	s.writeAPI(w, r, res)
+}
@@ -0,0 +1,16 @@
+//go:build !openapigen
+
+package web
+
+import _ "embed"
+
+// publishedOpenAPI and publishedOpenAPIV2 are the published specifications of
+// the versions of the API. A test fails if it does not match the one generated from the types,
+// so that the shape of the API cannot change unnoticed. After a deliberate
+// change, it is regenerated with go generate.
+//
+//go:embed openapi.json
+var publishedOpenAPI []byte
+
+//go:embed openapi-v2.json
+var publishedOpenAPIV2 []byte
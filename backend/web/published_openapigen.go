@@ -0,0 +1,7 @@
+//go:build openapigen
+
+package web
+
+// The specifications are not embedded when generating them, so that they can
+// be regenerated if they are missing.
+var publishedOpenAPI, publishedOpenAPIV2 []byte
@@ -0,0 +1,298 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/scraping"
+)
+
+// maxCachedQueries limits the number of cached responses to queries per
+// snapshot.
+const maxCachedQueries = 256
+
+// parkingQuery filters, sorts and projects the parkings of a snapshot.
+type parkingQuery struct {
+	zones    map[int]bool
+	operator string
+	minFree  int
+	open     bool
+	charging bool
+	bbox     *boundingBox
+	near     *parken.Coordinates
+	// radius is given in meters. If it is 0, the distance is not limited.
+	radius float64
+	sort   string
+	fields []string
+}
+
+var queryParameters = []string{"zone", "operator", "minFree", "open", "charging", "bbox", "near", "radius", "sort", "fields"}
+
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, errParameter
+	}
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, errParameter
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// parseParkingQuery parses the query parameters of /api/parkings:
+//
+//	zone      comma-separated IDs of zones
+//	operator  operator, compared case-insensitively
+//	minFree   minimum number of free spots
+//	open      whether the parking is open now
+//	charging  whether the parking has charging stations
+//	bbox      minLon,minLat,maxLon,maxLat
+//	near      lat,lon, adds the distance in meters to each parking
+//	radius    maximum distance from near in meters
+//	sort      free, distance or name
+//	fields    comma-separated fields to include
+//
+// It reports false if no parameter is given.
+func parseParkingQuery(values url.Values) (*parkingQuery, bool, error) {
+	q := &parkingQuery{}
+	given := false
+	for _, name := range queryParameters {
+		if values.Has(name) {
+			given = true
+		}
+	}
+	if !given {
+		return nil, false, nil
+	}
+	var err error
+	if v := values.Get("zone"); v != "" {
+		q.zones = make(map[int]bool)
+		for _, id := range strings.Split(v, ",") {
+			zone, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				return nil, true, errParameter
+			}
+			q.zones[zone] = true
+		}
+	}
+	q.operator = values.Get("operator")
+	if v := values.Get("minFree"); v != "" {
+		if q.minFree, err = strconv.Atoi(v); err != nil {
+			return nil, true, errParameter
+		}
+	}
+	if v := values.Get("open"); v != "" {
+		if q.open, err = strconv.ParseBool(v); err != nil {
+			return nil, true, errParameter
+		}
+	}
+	if v := values.Get("charging"); v != "" {
+		if q.charging, err = strconv.ParseBool(v); err != nil {
+			return nil, true, errParameter
+		}
+	}
+	if v := values.Get("bbox"); v != "" {
+		b, err := parseFloats(v, 4)
+		if err != nil {
+			return nil, true, err
+		}
+		q.bbox = &boundingBox{min: parken.Coordinates{Latitude: b[1], Longitude: b[0]},
+			max: parken.Coordinates{Latitude: b[3], Longitude: b[2]}}
+	}
+	if v := values.Get("near"); v != "" {
+		c, err := parseFloats(v, 2)
+		if err != nil {
+			return nil, true, err
+		}
+		q.near = &parken.Coordinates{Latitude: c[0], Longitude: c[1]}
+	}
+	if v := values.Get("radius"); v != "" {
+		if q.near == nil {
+			return nil, true, errParameter
+		}
+		if q.radius, err = strconv.ParseFloat(v, 64); err != nil || q.radius < 0 {
+			return nil, true, errParameter
+		}
+	}
+	switch q.sort = values.Get("sort"); q.sort {
+	case "", "free", "name":
+	case "distance":
+		if q.near == nil {
+			return nil, true, errParameter
+		}
+	default:
+		return nil, true, errParameter
+	}
+	if v := values.Get("fields"); v != "" {
+		q.fields = strings.Split(v, ",")
+	}
+	return q, true, nil
+}
+
+// key identifies the response to the query in the given format. Queries
+// depending on the current time are cached for a minute at most.
+func (q *parkingQuery) key(values url.Values, format string, now time.Time) string {
+	canonical := url.Values{}
+	for _, name := range queryParameters {
+		if v, ok := values[name]; ok {
+			canonical[name] = v
+		}
+	}
+	key := format + "?" + canonical.Encode()
+	if q.open {
+		key += "@" + now.Truncate(time.Minute).Format(time.RFC3339)
+	}
+	return key
+}
+
+func (q *parkingQuery) match(p *parken.Parking, now time.Time) bool {
+	if q.zones != nil && !q.zones[p.Zone] {
+		return false
+	}
+	if q.operator != "" && !strings.EqualFold(q.operator, p.Operator) {
+		return false
+	}
+	if p.Spots < q.minFree {
+		return false
+	}
+	if q.charging && p.ChargingStations == "" {
+		return false
+	}
+	located := !p.LocationPending && p.Coordinates != (parken.Coordinates{})
+	if q.bbox != nil && (!located || !q.bbox.contains(p.Coordinates)) {
+		return false
+	}
+	if q.near != nil && q.radius != 0 && (!located || distance(*q.near, p.Coordinates) > q.radius) {
+		return false
+	}
+	if q.open {
+		// Parkings with opening hours that cannot be interpreted are kept.
+		if open, known := openAt(p, now); known && !open {
+			return false
+		}
+	}
+	return true
+}
+
+// apply evaluates the query against the snapshot and returns the result
+// serialised in the given format. JSON results have the shape of the full
+// snapshot. Annotations are members added to the parkings with the given IDs.
+func (q *parkingQuery) apply(res scraping.Result, now time.Time, format string, annotations map[int]map[string]json.RawMessage) ([]byte, error) {
+	var parkings []parken.Parking
+	for i := range res.Parkings {
+		if q.match(&res.Parkings[i], now) {
+			parkings = append(parkings, res.Parkings[i])
+		}
+	}
+	distances := make(map[int]float64)
+	if q.near != nil {
+		for i := range parkings {
+			distances[parkings[i].ID] = distance(*q.near, parkings[i].Coordinates)
+		}
+	}
+	switch q.sort {
+	case "free":
+		sort.SliceStable(parkings, func(i, j int) bool { return parkings[i].Spots > parkings[j].Spots })
+	case "name":
+		sort.SliceStable(parkings, func(i, j int) bool { return parkings[i].Name < parkings[j].Name })
+	case "distance":
+		sort.SliceStable(parkings, func(i, j int) bool {
+			return distances[parkings[i].ID] < distances[parkings[j].ID]
+		})
+	}
+
+	projected := make([]json.RawMessage, len(parkings))
+	for i := range parkings {
+		data, err := json.Marshal(parkings[i])
+		if err != nil {
+			return nil, err
+		}
+		members := make(map[string]json.RawMessage, len(annotations[parkings[i].ID])+1)
+		for name, v := range annotations[parkings[i].ID] {
+			members[name] = v
+		}
+		if d, ok := distances[parkings[i].ID]; ok {
+			members["distance"] = json.RawMessage(strconv.FormatFloat(d, 'f', 0, 64))
+		}
+		if len(members) != 0 || q.fields != nil {
+			if data, err = q.project(data, members); err != nil {
+				return nil, err
+			}
+		}
+		projected[i] = data
+	}
+	if format != "json" {
+		records := make([]map[string]any, len(projected))
+		for i, data := range projected {
+			record, err := decodeRecord(data)
+			if err != nil {
+				return nil, err
+			}
+			records[i] = record
+		}
+		switch format {
+		case "csv":
+			return encodeCSV(records)
+		case "geojson":
+			return encodeGeoJSON(res.Updated, parkings, records)
+		case "xml":
+			return encodeXML(res.Updated, res.Zones, records)
+		}
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return json.Marshal(struct {
+		Updated  time.Time         `json:"updated"`
+		Zones    map[int]string    `json:"zones"`
+		Parkings []json.RawMessage `json:"parkings"`
+	}{res.Updated, res.Zones, projected})
+}
+
+// render applies the query and converts JSON results into the given format and
+// mode.
+func (q *parkingQuery) render(res scraping.Result, now time.Time, format string, compact bool, annotations map[int]map[string]json.RawMessage) ([]byte, error) {
+	if format == "msgpack" {
+		data, err := q.apply(res, now, "json", annotations)
+		if err != nil {
+			return nil, err
+		}
+		return represent(data, format, compact, res)
+	}
+	data, err := q.apply(res, now, format, annotations)
+	if err != nil || format != "json" {
+		return data, err
+	}
+	return represent(data, format, compact, res)
+}
+
+// project adds the members, such as the distance, to a serialised parking and
+// removes the fields that were not selected.
+func (q *parkingQuery) project(data []byte, members map[string]json.RawMessage) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, v := range members {
+		fields[name] = v
+	}
+	if q.fields != nil {
+		selected := make(map[string]json.RawMessage, len(q.fields))
+		for _, name := range q.fields {
+			if v, ok := fields[strings.TrimSpace(name)]; ok {
+				selected[strings.TrimSpace(name)] = v
+			}
+		}
+		fields = selected
+	}
+	return json.Marshal(fields)
+}
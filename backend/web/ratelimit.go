@@ -0,0 +1,180 @@
+package web
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the interval at which the buckets of idle clients are
+// dropped.
+const sweepInterval = time.Minute
+
+// RateLimit allows Requests requests per Interval with bursts of up to Burst
+// requests, which defaults to Requests. It is disabled if Requests is 0.
+type RateLimit struct {
+	Requests int
+	Interval time.Duration
+	Burst    int
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rate returns the number of requests per second.
+func (l RateLimit) rate() float64 {
+	return float64(l.Requests) / l.Interval.Seconds()
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter implements token buckets per client.
+type limiter struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{buckets: make(map[string]*bucket)}
+}
+
+// refill returns the tokens of the bucket at the given time.
+func (b *bucket) refill(limit RateLimit, now time.Time) float64 {
+	return math.Min(limit.burst(), b.tokens+now.Sub(b.last).Seconds()*limit.rate())
+}
+
+// allow takes a token from the bucket of the client. If there is none, it
+// returns the time until the next token is available.
+func (l *limiter) allow(client string, limit RateLimit, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		for client, b := range l.buckets {
+			if b.refill(limit, now) >= limit.burst() {
+				delete(l.buckets, client)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: limit.burst(), last: now}
+		l.buckets[client] = b
+	}
+	b.tokens, b.last = b.refill(limit, now), now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / limit.rate() * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *limiter) len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.buckets)
+}
+
+func (s *Server) trusted(ip netip.Addr) bool {
+	for _, prefix := range s.TrustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP of the client. If the request passed trusted
+// proxies, it is the last untrusted address of X-Forwarded-For.
+func (s *Server) clientIP(r *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	ip := addrPort.Addr().Unmap()
+	if !s.trusted(ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		ip = addr.Unmap()
+		if !s.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// clientID identifies the client of the request for rate limiting. IPv6
+// clients are identified by their /64 network, which is usually assigned to a
+// single host.
+func (s *Server) clientID(r *http.Request) string {
+	ip := s.clientIP(r)
+	if ip.Is6() {
+		prefix, _ := ip.Prefix(64)
+		return prefix.String()
+	}
+	return ip.String()
+}
+
+// limit applies the daily quotas of API keys and the rate limits to the
+// handler of the route. Requests with an API key are limited per key, all
+// others per client IP.
+func (s *Server) limit(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := s.apiKey(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `APIKey header="X-API-Key"`)
+			httpError(w, http.StatusUnauthorized)
+			return
+		}
+		now := time.Now()
+		kind, l, limit, client := "ip", s.ipLimiter, s.RateLimit, ""
+		if key.Consumer != "" {
+			kind, l, limit, client = "key", s.keyLimiter, s.KeyRateLimit, key.Consumer
+		}
+		if limit.Requests != 0 {
+			if client == "" {
+				client = s.clientID(r)
+			}
+			allowed, retryAfter := l.allow(client, limit, now)
+			if !allowed {
+				s.metrics.rateLimited.WithLabelValues(kind).Inc()
+				tooManyRequests(w, retryAfter)
+				return
+			}
+		}
+		// Only requests within the rate limit count towards the quota.
+		if key.Consumer != "" {
+			allowed, retryAfter := s.usage.count(key, route, now)
+			if !allowed {
+				s.metrics.quotaExceeded.WithLabelValues(key.Consumer).Inc()
+				tooManyRequests(w, retryAfter)
+				return
+			}
+			s.metrics.apiKeyRequests.WithLabelValues(key.Consumer, route).Inc()
+		}
+		handler(w, r)
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	httpError(w, http.StatusTooManyRequests)
+}
@@ -0,0 +1,25 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLimitQuota(t *testing.T) {
+	s := newTestServer(t)
+	s.APIKeys = map[string]APIKey{"secret": {Consumer: "app", DailyQuota: 2}}
+	s.KeyRateLimit = RateLimit{Requests: 1, Interval: time.Hour}
+	handler := s.limit("/parkings", func(w http.ResponseWriter, r *http.Request) {})
+	for i, status := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if w := serve(handler, "/api/parkings", "X-API-Key", "secret"); w.Code != status {
+			t.Errorf("request %d: got status %d, want %d", i, w.Code, status)
+		}
+	}
+	if today := s.usage.get("app").Today; today != 1 {
+		t.Errorf("got %d requests counted towards the quota, want 1", today)
+	}
+	if w := serve(handler, "/api/parkings", "X-API-Key", "unknown"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
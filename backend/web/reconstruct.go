@@ -0,0 +1,186 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/scraping"
+)
+
+const (
+	// reconstructionWindow is the number of stale ages before the time of a
+	// reconstructed snapshot in which samples are searched, which bounds the
+	// scan of the history.
+	reconstructionWindow = 4
+	// minReconstructionWindow is searched at least, so that parkings are
+	// not left out because upstream did not update them for a while, e.g. at
+	// night.
+	minReconstructionWindow = 24 * time.Hour
+)
+
+// metadataOf serialises the parking without its free spots.
+func metadataOf(p parken.Parking) ([]byte, error) {
+	p.Spots = 0
+	return json.Marshal(p)
+}
+
+// recordMetadata inserts the metadata of the parkings that changed since it was
+// last recorded and marks the parkings that were removed. Parkings whose
+// coordinates are pending are recorded after the next update once they have
+// been located, so that reconstructions keep their geometry. The caller must
+// hold s.dbMutex.
+func (s *Server) recordMetadata(updated time.Time, parkings []parken.Parking) error {
+	if s.metadata == nil {
+		metadata, err := s.Store().Metadata(time.Time{})
+		if err != nil {
+			return err
+		}
+		s.metadata = metadata
+	}
+	insert := func(id int, data []byte) error {
+		start := time.Now()
+		err := s.Store().SaveMetadata(id, updated, data)
+		s.metrics.recordInsert("metadata", start, err)
+		if err == nil {
+			s.metadata[id] = data
+		}
+		return err
+	}
+	present := make(map[int]bool, len(parkings))
+	for _, p := range parkings {
+		present[p.ID] = true
+		if p.LocationPending {
+			continue
+		}
+		data, err := metadataOf(p)
+		if err != nil {
+			return err
+		}
+		if last, ok := s.metadata[p.ID]; ok && bytes.Equal(last, data) {
+			continue
+		}
+		if err := insert(p.ID, data); err != nil {
+			return err
+		}
+	}
+	for id, last := range s.metadata {
+		if !present[id] && last != nil {
+			if err := insert(id, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotAt reconstructs the snapshot at the given time from the latest
+// sample of each parking at or before it and the metadata valid at that time.
+// Parkings without a sample in the reconstruction window are left out.
+// Parkings sampled before their metadata was first recorded take it from the
+// current snapshot. The parkings are annotated with the time of their sample
+// and whether it is stale. The zones are taken from the current snapshot.
+func (s *Server) snapshotAt(at time.Time) (scraping.Result, map[int]map[string]json.RawMessage, error) {
+	s.mutex.RLock()
+	zones, current, staleAfter := s.zones, s.parkings, s.staleAfter()
+	s.mutex.RUnlock()
+
+	s.dbMutex.Lock()
+	if s.Store() == nil {
+		s.dbMutex.Unlock()
+		return scraping.Result{}, nil, errNoDB
+	}
+	window := max(reconstructionWindow*staleAfter, minReconstructionWindow)
+	samples, err := s.Store().SamplesAt(at.Add(-window), at)
+	var metadata map[int][]byte
+	if err == nil {
+		metadata, err = s.Store().Metadata(at)
+	}
+	s.dbMutex.Unlock()
+	if err != nil {
+		return scraping.Result{}, nil, err
+	}
+
+	currentByID := make(map[int]parken.Parking, len(current))
+	for _, p := range current {
+		currentByID[p.ID] = p
+	}
+	res := scraping.Result{Zones: zones, Parkings: []parken.Parking{}}
+	annotations := make(map[int]map[string]json.RawMessage, len(samples))
+	for id, smpl := range samples {
+		var p parken.Parking
+		if data, ok := metadata[id]; ok {
+			if data == nil {
+				// The parking had been removed.
+				continue
+			}
+			if err := json.Unmarshal(data, &p); err != nil {
+				return scraping.Result{}, nil, err
+			}
+		} else if p, ok = currentByID[id]; !ok {
+			continue
+		}
+		p.Spots = smpl.Free
+		res.Parkings = append(res.Parkings, p)
+		if smpl.Time.After(res.Updated) {
+			res.Updated = smpl.Time
+		}
+		sampled, err := json.Marshal(smpl.Time)
+		if err != nil {
+			return scraping.Result{}, nil, err
+		}
+		stale := staleAfter != 0 && at.Sub(smpl.Time) > staleAfter
+		annotations[id] = map[string]json.RawMessage{"sampled": sampled, "stale": json.RawMessage(strconv.FormatBool(stale))}
+	}
+	sort.Slice(res.Parkings, func(i, j int) bool {
+		return res.Parkings[i].ID < res.Parkings[j].ID
+	})
+	return res, annotations, nil
+}
+
+// serveSnapshotAt serves the snapshot at the given time, filtered by the query
+// with the given key, in the given format and mode. Snapshots preceding the
+// current one do not change, so that their responses are cached.
+func (s *Server) serveSnapshotAt(w http.ResponseWriter, r *http.Request, at time.Time, q *parkingQuery, key, format string, compact bool) {
+	key = at.Format(time.RFC3339) + ";" + key
+	s.mutex.RLock()
+	body, ok := s.pastQueries[key]
+	past := at.Before(s.updated)
+	s.mutex.RUnlock()
+	if ok {
+		serveCached(w, r, body, publicMaxAge(s.maxAge()))
+		return
+	}
+	res, annotations, err := s.snapshotAt(at)
+	if err != nil {
+		if err == errNoDB {
+			httpError(w, http.StatusServiceUnavailable)
+			return
+		}
+		s.log().Error("reconstructing snapshot", "at", at, "error", err)
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+	data, err := q.render(res, at, format, compact, annotations)
+	if err == nil {
+		body, err = newCachedBody(contentTypes[format], data, res.Updated)
+	}
+	if err != nil {
+		s.log().Error("querying parkings", "at", at, "error", err)
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+	if past {
+		s.mutex.Lock()
+		if s.pastQueries == nil || len(s.pastQueries) >= maxCachedQueries {
+			s.pastQueries = make(map[string]*cachedBody)
+		}
+		s.pastQueries[key] = body
+		s.mutex.Unlock()
+	}
+	serveCached(w, r, body, publicMaxAge(s.maxAge()))
+}
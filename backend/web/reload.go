@@ -0,0 +1,51 @@
+package web
+
+import (
+	"github.com/relseah/parken"
+)
+
+// ReloadCoordinates replaces the coordinate presets and rereads the coordinates
+// stored in the database. Parkings whose preset or stored coordinates changed
+// are located again in the current snapshot; parkings left without coordinates
+// are queued for geocoding.
+func (s *Server) ReloadCoordinates(presets map[int]parken.Coordinates) error {
+	var coordinatesDB map[int]parken.Coordinates
+	s.dbMutex.Lock()
+	st := s.Store()
+	s.dbMutex.Unlock()
+	if st != nil {
+		var err error
+		if coordinatesDB, err = s.queryCoordinates(); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	changed := make(map[int]bool)
+	diff := func(a, b map[int]parken.Coordinates) {
+		for id, coordinates := range a {
+			if other, ok := b[id]; !ok || other != coordinates {
+				changed[id] = true
+			}
+		}
+	}
+	diff(s.presets, presets)
+	diff(presets, s.presets)
+	diff(s.coordinatesDB, coordinatesDB)
+	diff(coordinatesDB, s.coordinatesDB)
+	s.presets, s.coordinatesDB = presets, coordinatesDB
+	if len(changed) == 0 {
+		return nil
+	}
+	for id := range changed {
+		delete(s.coordinates, id)
+		delete(s.addresses, id)
+	}
+
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	s.log().Info("reloaded coordinates", "changed", len(changed))
+	return nil
+}
@@ -0,0 +1,267 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+const (
+	// streamBacklog is the number of past events kept for clients resuming a
+	// stream.
+	streamBacklog = 64
+	// subscriberBuffer is the number of events buffered per subscriber. Slow
+	// subscribers are disconnected and may resume the stream.
+	subscriberBuffer  = 8
+	heartbeatInterval = 30 * time.Second
+	// defaultMaxSubscribers is used if Server.MaxSubscribers is 0.
+	defaultMaxSubscribers = 256
+)
+
+type event struct {
+	seq  int
+	name string
+	data []byte
+	// compact is data in compact mode.
+	compact []byte
+}
+
+// payload returns the data of the event in the given mode.
+func (e event) payload(compact bool) []byte {
+	if compact {
+		return e.compact
+	}
+	return e.data
+}
+
+// delta contains the parkings that were added or changed since the previous
+// event and the IDs of the removed ones.
+type delta struct {
+	Updated  time.Time        `json:"updated"`
+	Parkings []parken.Parking `json:"parkings"`
+	Removed  []int            `json:"removed"`
+}
+
+// stream distributes the changes of the snapshot to the subscribers of the
+// event stream. The IDs of events consist of the time the stream was created
+// and a sequence number, so that IDs from a previous process are not mistaken
+// for current ones.
+type stream struct {
+	mutex       sync.Mutex
+	epoch       int64
+	seq         int
+	backlog     []event
+	subscribers map[chan event]struct{}
+}
+
+func newStream() *stream {
+	return &stream{epoch: time.Now().Unix(), subscribers: make(map[chan event]struct{})}
+}
+
+func (st *stream) id(seq int) string {
+	return fmt.Sprintf("%d-%d", st.epoch, seq)
+}
+
+// parseID returns the sequence number of an event ID from this stream.
+func (st *stream) parseID(id string) (int, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != strconv.FormatInt(st.epoch, 10) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(seq)
+	return n, err == nil
+}
+
+func (st *stream) subscribe(max int) (chan event, bool) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if len(st.subscribers) >= max {
+		return nil, false
+	}
+	c := make(chan event, subscriberBuffer)
+	st.subscribers[c] = struct{}{}
+	return c, true
+}
+
+func (st *stream) unsubscribe(c chan event) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if _, ok := st.subscribers[c]; ok {
+		delete(st.subscribers, c)
+		close(c)
+	}
+}
+
+func (st *stream) broadcast(name string, data, compact []byte) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.seq++
+	e := event{seq: st.seq, name: name, data: data, compact: compact}
+	if len(st.backlog) == streamBacklog {
+		st.backlog = st.backlog[1:]
+	}
+	st.backlog = append(st.backlog, e)
+	for c := range st.subscribers {
+		select {
+		case c <- e:
+		default:
+			delete(st.subscribers, c)
+			close(c)
+		}
+	}
+}
+
+// since returns the events following the event with the given ID and the
+// sequence number of the latest event. It reports false if the events are not
+// available anymore.
+func (st *stream) since(id string) ([]event, int, bool) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	seq, ok := st.parseID(id)
+	if !ok || seq > st.seq {
+		return nil, st.seq, false
+	}
+	if seq == st.seq {
+		return nil, st.seq, true
+	}
+	if len(st.backlog) == 0 || st.backlog[0].seq > seq+1 {
+		return nil, st.seq, false
+	}
+	return append([]event(nil), st.backlog[seq+1-st.backlog[0].seq:]...), st.seq, true
+}
+
+func (st *stream) current() int {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	return st.seq
+}
+
+func diffParkings(old, parkings []parken.Parking) ([]parken.Parking, []int) {
+	previous := make(map[int]*parken.Parking, len(old))
+	for i := range old {
+		previous[old[i].ID] = &old[i]
+	}
+	changed := []parken.Parking{}
+	for i := range parkings {
+		p, ok := previous[parkings[i].ID]
+		if !ok || !reflect.DeepEqual(*p, parkings[i]) {
+			changed = append(changed, parkings[i])
+		}
+		delete(previous, parkings[i].ID)
+	}
+	removed := []int{}
+	for id := range previous {
+		removed = append(removed, id)
+	}
+	return changed, removed
+}
+
+// publishDelta broadcasts the changes between two snapshots. The caller must
+// hold s.mutex.
+func (s *Server) publishDelta(updated time.Time, old, parkings []parken.Parking) {
+	changed, removed := diffParkings(old, parkings)
+	if len(changed) == 0 && len(removed) == 0 && !updated.After(s.updated) {
+		return
+	}
+	data, err := json.Marshal(delta{Updated: updated, Parkings: changed, Removed: removed})
+	if err != nil {
+		s.log().Error("marshalling delta", "error", err)
+		return
+	}
+	compact, err := represent(data, "json", true, nil)
+	if err != nil {
+		s.log().Error("compacting delta", "error", err)
+		return
+	}
+	s.stream.broadcast("delta", data, compact)
+}
+
+func writeEvent(w http.ResponseWriter, id, name string, data []byte) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, name, data)
+	return err
+}
+
+// streamHandler serves Server-Sent Events. Clients receive a snapshot event
+// with the current snapshot followed by delta events after each change. A
+// client passing the ID of the last received event in Last-Event-ID receives
+// the missed deltas instead of a snapshot, if they are still available. The
+// events are in compact mode like the other resources of the API.
+func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+	compact, err := compactMode(r)
+	if err != nil {
+		httpError(w, http.StatusBadRequest)
+		return
+	}
+	max := s.MaxSubscribers
+	if max == 0 {
+		max = defaultMaxSubscribers
+	}
+	events, ok := s.stream.subscribe(max)
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(heartbeatInterval.Seconds())))
+		httpError(w, http.StatusServiceUnavailable)
+		return
+	}
+	defer s.stream.unsubscribe(events)
+	// Streams outlive the write timeout of the server.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", heartbeatInterval.Milliseconds())
+
+	missed, seq, ok := s.stream.since(r.Header.Get("Last-Event-ID"))
+	if ok {
+		for _, e := range missed {
+			writeEvent(w, s.stream.id(e.seq), e.name, e.payload(compact))
+		}
+	} else {
+		s.mutex.RLock()
+		// The snapshot matches the latest event, which is broadcast while
+		// holding s.mutex.
+		cache := s.cache
+		seq = s.stream.current()
+		s.mutex.RUnlock()
+		writeEvent(w, s.stream.id(seq), "snapshot", cache.get("json", compact).identity())
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			// Events preceding the snapshot or the missed events are skipped.
+			if e.seq <= seq {
+				continue
+			}
+			seq = e.seq
+			if err := writeEvent(w, s.stream.id(e.seq), e.name, e.payload(compact)); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+type testEvent struct {
+	id, name, data string
+}
+
+// subscribe connects to the event stream and returns a function reading its
+// events, which skips the retry field preceding them.
+func subscribe(t *testing.T, url string, header ...string) (*http.Response, func() testEvent) {
+	t.Helper()
+	r, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	reader := bufio.NewReader(resp.Body)
+	return resp, func() testEvent {
+		t.Helper()
+		var e testEvent
+		for e.name == "" {
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatalf("reading event: %v", err)
+				}
+				line = strings.TrimSuffix(line, "\n")
+				if line == "" {
+					break
+				}
+				field, value, _ := strings.Cut(line, ": ")
+				switch field {
+				case "id":
+					e.id = value
+				case "event":
+					e.name = value
+				case "data":
+					e.data = value
+				}
+			}
+		}
+		return e
+	}
+}
+
+func TestStream(t *testing.T) {
+	s := newTestServer(t, parken.Parking{ID: 1, Spots: 10}, parken.Parking{ID: 2, Spots: 5})
+	s.MaxSubscribers = 2
+	// The server is closed after the responses, which are closed by cleanups.
+	server := httptest.NewServer(http.HandlerFunc(s.streamHandler))
+	t.Cleanup(server.Close)
+
+	var next []func() testEvent
+	for i := 0; i < 2; i++ {
+		resp, read := subscribe(t, server.URL)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("subscriber %d: got status %d and type %q", i, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		// The subscription precedes the snapshot.
+		if e := read(); e.name != "snapshot" || e.id != s.stream.id(1) {
+			t.Fatalf("subscriber %d: got event %s with ID %s, want snapshot with ID %s", i, e.name, e.id, s.stream.id(1))
+		}
+		next = append(next, read)
+	}
+	resp, _ := subscribe(t, server.URL)
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("subscriber beyond the limit: got status %d and Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	s.setTestSnapshot(t, testUpdated.Add(time.Minute), parken.Parking{ID: 1, Spots: 8})
+	for i, read := range next {
+		e := read()
+		if e.name != "delta" || e.id != s.stream.id(2) {
+			t.Fatalf("subscriber %d: got event %s with ID %s, want delta with ID %s", i, e.name, e.id, s.stream.id(2))
+		}
+		var d delta
+		if err := json.Unmarshal([]byte(e.data), &d); err != nil {
+			t.Fatal(err)
+		}
+		if len(d.Parkings) != 1 || d.Parkings[0].Spots != 8 || len(d.Removed) != 1 || d.Removed[0] != 2 {
+			t.Errorf("subscriber %d: got delta %s", i, e.data)
+		}
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	s := newTestServer(t, parken.Parking{ID: 1, Spots: 10})
+	for i := 1; i <= 2; i++ {
+		s.setTestSnapshot(t, testUpdated.Add(time.Duration(i)*time.Minute), parken.Parking{ID: 1, Spots: 10 - i})
+	}
+	server := httptest.NewServer(http.HandlerFunc(s.streamHandler))
+	t.Cleanup(server.Close)
+	tests := []struct {
+		lastEventID string
+		name        string
+		seq         int
+	}{
+		{"", "snapshot", 3},
+		{s.stream.id(1), "delta", 2},
+		{s.stream.id(2), "delta", 3},
+		{s.stream.id(4), "snapshot", 3},
+		{"1-1", "snapshot", 3},
+		{"invalid", "snapshot", 3},
+	}
+	for _, test := range tests {
+		_, read := subscribe(t, server.URL, "Last-Event-ID", test.lastEventID)
+		if e := read(); e.name != test.name || e.id != s.stream.id(test.seq) {
+			t.Errorf("Last-Event-ID %q: got event %s with ID %s, want %s with ID %s",
+				test.lastEventID, e.name, e.id, test.name, s.stream.id(test.seq))
+		}
+	}
+}
@@ -2,247 +2,447 @@ package web
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
+	"log/slog"
 	"mime"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-
 	"github.com/relseah/parken"
 	"github.com/relseah/parken/nominatim"
 	"github.com/relseah/parken/scraping"
+	"github.com/relseah/parken/store"
 )
 
-const timeLayout = "2006-01-02 15:04:05"
+// apiPrefix is the prefix of the routes of the first version of the API, which
+// are also served without the version. Version 2 differs in responding in
+// compact mode by default.
+const (
+	apiPrefix   = "/api/v1"
+	apiV2Prefix = "/api/v2"
+)
+
+// apiPath splits the path of a request to the API into its prefix, either
+// /api, /api/v1 or /api/v2, and the path of the resource.
+func apiPath(r *http.Request) (prefix, path string) {
+	for _, prefix := range []string{apiPrefix, apiV2Prefix} {
+		if path, ok := strings.CutPrefix(r.URL.Path, prefix); ok {
+			return prefix, path
+		}
+	}
+	return "/api", strings.TrimPrefix(r.URL.Path, "/api")
+}
 
 type Server struct {
 	*http.Server
 	Scraper *scraping.Scraper
 	Client  *nominatim.Client
-	Logger  *log.Logger
-
-	cache []byte
-
+	Logger  *slog.Logger
+	// PredictionURL is the base URL of the prediction service, which is
+	// linked to as the forecast of a parking.
+	PredictionURL *url.URL
+	// TilesPath is the directory of the map tiles served below /tiles/.
+	// Tiles are not served if it is empty.
+	TilesPath string
+	// MaxSubscribers limits the number of concurrent subscribers of the event
+	// stream.
+	MaxSubscribers int
+	// StaleIntervals is the number of scraping intervals after the last
+	// successful scrape, after which the server is not ready anymore.
+	StaleIntervals int
+	// Reload is called on POST /admin/reload to reload the configuration.
+	Reload func() error
+	// RateLimit limits the requests to the API per client IP and KeyRateLimit
+	// the ones per API key.
+	RateLimit    RateLimit
+	KeyRateLimit RateLimit
+	// TrustedProxies are the networks of the reverse proxies whose
+	// X-Forwarded-For header is trusted.
+	TrustedProxies []netip.Prefix
+	// APIKeys maps API keys to their consumers.
+	APIKeys map[string]APIKey
+	CORS    CORS
+	// AdminKeys maps the names of the keys of the admin API to their secrets.
+	// The admin API is disabled if there are none.
+	AdminKeys map[string]string
+
+	// mutex guards the current snapshot and the geocoding state.
+	mutex sync.RWMutex
+	cache *snapshotCache
+	// queries caches the responses to queries of the current snapshot.
+	queries map[string]*cachedBody
+	// pastQueries caches the responses to queries of reconstructed
+	// snapshots, which are reset with the store.
+	pastQueries map[string]*cachedBody
+
+	// upstream holds the parkings as scraped, which parkings is derived from.
+	upstream      []parken.Parking
 	parkings      []parken.Parking
+	zones         map[int]string
 	updated       time.Time
 	coordinates   map[int]parken.Coordinates
 	presets       map[int]parken.Coordinates
 	coordinatesDB map[int]parken.Coordinates
-
-	db                    *sql.DB
-	dbMutex               sync.Mutex
-	insertCoordinatesStmt *sql.Stmt
-	insertSpotsStmt       *sql.Stmt
-
-	ticker *time.Ticker
-	done   chan struct{}
+	addresses     map[int]parken.Address
+	overrides     map[int]override
+	stream        *stream
+	metrics       *serverMetrics
+	index         *spatialIndex
+	// versions holds the recent snapshots of the parkings, the latest of
+	// which is the current one.
+	versions []version
+	// evicted is the time of the snapshot last dropped from versions.
+	evicted time.Time
+
+	pending       map[int]bool
+	geocoding     chan parken.Parking
+	geocodingDone chan struct{}
+	geocodingOnce sync.Once
+
+	ipLimiter  *limiter
+	keyLimiter *limiter
+	usage      *usage
+
+	// adminMutex serializes the changes made through the admin API.
+	adminMutex sync.Mutex
+
+	store   store.Store
+	dbMutex sync.Mutex
+	// metadata holds the latest recorded metadata of each parking. It is read
+	// from the database before the first metadata is recorded.
+	metadata map[int][]byte
+
+	ticker       *time.Ticker
+	done         chan struct{}
+	interval     time.Duration
+	nextScrape   time.Time
+	scrapeStatus scrapeStatus
+	scrapeID     atomic.Int64
 }
 
-func (s *Server) logf(format string, v ...any) {
-	logger := s.Logger
-	if logger != nil {
-		logger.Printf(format, v...)
-	}
-}
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
 
-func (s *Server) logln(v ...any) {
+// log returns the logger of the server, which discards records if the server
+// has none.
+func (s *Server) log() *slog.Logger {
 	logger := s.Logger
 	if logger != nil {
-		logger.Println(v...)
+		return logger
 	}
+	return discardLogger
 }
 
 var errorMessages = map[int]string{
+	http.StatusBadRequest:          "Bad Request",
+	http.StatusUnauthorized:        "Unauthorized",
+	http.StatusForbidden:           "Forbidden",
+	http.StatusMethodNotAllowed:    "Method Not Allowed",
 	http.StatusNotFound:            "Not Found",
+	http.StatusNotAcceptable:       "Not Acceptable",
+	http.StatusTooManyRequests:     "Too Many Requests",
 	http.StatusInternalServerError: "Internal Server Error",
+	http.StatusServiceUnavailable:  "Service Unavailable",
 }
 
 func httpError(w http.ResponseWriter, code int) {
 	http.Error(w, fmt.Sprintf("%d %s", code, errorMessages[code]), code)
 }
 
-func (s *Server) parkingsHandler(w http.ResponseWriter, r *http.Request) {
-	// The correct Content-Type is not detected.
+func (s *Server) writeJSON(w http.ResponseWriter, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		s.log().Error("marshalling response", "error", err)
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(s.cache)
+	w.Write(body)
 }
 
-func compressedFileServer(root http.FileSystem, extensions []string) http.Handler {
-	handler := http.FileServer(root)
-	// Unclear, whether the mime package caches the types.
-	types := make(map[string]string)
-	for _, extension := range extensions {
-		types[extension] = mime.TypeByExtension(extension)
-	}
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		for _, extension := range extensions {
-			if strings.HasSuffix(r.URL.Path, extension) {
-				accepted := strings.Split(r.Header.Get("Accept-Encoding"), ", ")
-				for _, encoding := range accepted {
-					if encoding == "gzip" {
-						r.URL.Path += ".gz"
-						w.Header().Add("Content-Encoding", "gzip")
-						w.Header().Add("Content-Type", types[extension])
-						break
-					}
-				}
-				break
-			}
+// newSnapshotCache precomputes the representations of the snapshot in JSON
+// and MessagePack, each in full and compact mode.
+func newSnapshotCache(res scraping.Result) (*snapshotCache, error) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	c := &snapshotCache{}
+	for _, v := range []struct {
+		cache   **cachedBody
+		format  string
+		compact bool
+	}{{&c.json, "json", false}, {&c.compactJSON, "json", true}, {&c.msgpack, "msgpack", false}, {&c.compactMsgpack, "msgpack", true}} {
+		represented, err := represent(data, v.format, v.compact, res)
+		if err != nil {
+			return nil, err
+		}
+		if *v.cache, err = newCachedBody(contentTypes[v.format], represented, res.Updated); err != nil {
+			return nil, err
 		}
-		handler.ServeHTTP(w, r)
-	})
+	}
+	return c, nil
 }
 
-func (s *Server) queryCoordinates() error {
-	s.dbMutex.Lock()
-	defer s.dbMutex.Unlock()
-	rows, err := s.DB().Query("SELECT parking_id, latitude, longitude FROM coordinates;")
-	if err != nil {
-		return err
+// maxAge returns the time until the next scheduled scrape.
+func (s *Server) maxAge() time.Duration {
+	s.mutex.RLock()
+	next := s.nextScrape
+	s.mutex.RUnlock()
+	if next.IsZero() {
+		return 0
+	}
+	if d := time.Until(next); d > 0 {
+		return d
 	}
-	defer rows.Close()
-	coordinates := make(map[int]parken.Coordinates)
-	var id int
-	var current parken.Coordinates
-	for rows.Next() {
-		rows.Scan(&id, &current.Latitude, &current.Longitude)
-		coordinates[id] = current
+	return 0
+}
+
+// setSnapshot replaces the current snapshot. The caller must hold s.mutex.
+func (s *Server) setSnapshot(res scraping.Result, cache *snapshotCache) {
+	s.publishDelta(res.Updated, s.parkings, res.Parkings)
+	s.recordVersion(res.Updated, res.Parkings)
+	s.updated, s.zones, s.parkings, s.cache = res.Updated, res.Zones, res.Parkings, cache
+	s.queries = make(map[string]*cachedBody)
+	s.index = newSpatialIndex(res.Parkings)
+	s.metrics.recordParkings(res.Parkings)
+}
+
+// resolve returns copies of the upstream parkings with their overrides applied
+// and their coordinates located. Parkings that need geocoding are enqueued. The
+// caller must hold s.mutex.
+func (s *Server) resolve(upstream []parken.Parking) []parken.Parking {
+	parkings := make([]parken.Parking, len(upstream))
+	copy(parkings, upstream)
+	for i := 0; i < len(parkings); i++ {
+		p := &parkings[i]
+		s.overrides[p.ID].apply(p)
+		if s.locate(p) {
+			s.enqueue(*p)
+		}
 	}
-	if err := rows.Err(); err != nil {
+	return parkings
+}
+
+// refresh rebuilds the current snapshot from the upstream parkings. The caller
+// must hold s.mutex.
+func (s *Server) refresh() error {
+	res := scraping.Result{Updated: s.updated, Zones: s.zones, Parkings: s.resolve(s.upstream)}
+	cache, err := newSnapshotCache(res)
+	if err != nil {
 		return err
 	}
-	s.coordinatesDB = coordinates
+	s.setSnapshot(res, cache)
 	return nil
 }
 
-func (s *Server) obtainCoordinates(p *parken.Parking) (parken.Coordinates, error) {
-	if preset, ok := s.presets[p.ID]; ok {
-		return preset, nil
+// parkingFormats are the formats of /api/parkings, the first of which is the
+// default.
+var parkingFormats = []string{"json", "msgpack", "csv", "geojson", "xml"}
+
+// parkingsHandler serves the snapshot, optionally filtered by a query, in the
+// negotiated format. With the parameter at, the snapshot at that time is
+// reconstructed from the database.
+func (s *Server) parkingsHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok, err := parseParkingQuery(r.URL.Query())
+	if err != nil {
+		httpError(w, http.StatusBadRequest)
+		return
 	}
-	if coordinates, ok := s.coordinatesDB[p.ID]; ok {
-		return coordinates, nil
+	format, code := negotiateFormat(r, parkingFormats)
+	if code != 0 {
+		httpError(w, code)
+		return
 	}
-	results, err := s.Client.Search(p)
+	compact, err := compactMode(r)
 	if err != nil {
-		return parken.Coordinates{}, fmt.Errorf("searching for coordinates of parking with ID %d: %w", p.ID, err)
-	}
-	if len(results) == 0 {
-		s.logf("No results for parking P%d %s.\n", p.ID, p.Name)
-	} else if len(results) > 1 {
-		var b strings.Builder
-		fmt.Fprintf(&b, "Multiple results for parking P%d %s.\n", p.ID, p.Name)
-		for i, c := range results {
-			fmt.Fprintf(&b, "%d. Latitude: %f°, longitude: %f°\n", i, c.Latitude, c.Longitude)
+		httpError(w, http.StatusBadRequest)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	if v := r.URL.Query().Get("at"); v != "" {
+		at, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, http.StatusBadRequest)
+			return
 		}
-		logger := s.Logger
-		if logger != nil {
-			logger.Print(b.String())
+		if !ok {
+			q = &parkingQuery{}
 		}
-	} else {
-		coordinates := results[0]
-		_, err = s.insertCoordinatesStmt.Exec(p.ID, coordinates.Latitude, coordinates.Longitude)
-		return coordinates, err
+		key := q.key(r.URL.Query(), format, at)
+		if compact {
+			key += "!compact"
+		}
+		s.serveSnapshotAt(w, r, at.UTC(), q, key, format, compact)
+		return
 	}
-	return parken.Coordinates{}, nil
+	s.mutex.RLock()
+	res := scraping.Result{Updated: s.updated, Zones: s.zones, Parkings: s.parkings}
+	cache := s.cache
+	s.mutex.RUnlock()
+	if !ok {
+		if format == "json" || format == "msgpack" {
+			serveCached(w, r, cache.get(format, compact), publicMaxAge(s.maxAge()))
+			return
+		}
+		q = &parkingQuery{}
+	}
+
+	now := time.Now()
+	key := q.key(r.URL.Query(), format, now)
+	if compact {
+		key += "!compact"
+	}
+	s.mutex.RLock()
+	queryCache, ok := s.queries[key]
+	s.mutex.RUnlock()
+	if !ok {
+		var data []byte
+		data, err = q.render(res, now, format, compact, nil)
+		if err == nil {
+			queryCache, err = newCachedBody(contentTypes[format], data, res.Updated)
+		}
+		if err != nil {
+			s.log().Error("querying parkings", "error", err)
+			httpError(w, http.StatusInternalServerError)
+			return
+		}
+		s.mutex.Lock()
+		// The response is only cached if the snapshot has not been replaced
+		// in the meantime.
+		if s.cache == cache {
+			if len(s.queries) >= maxCachedQueries {
+				s.queries = make(map[string]*cachedBody)
+			}
+			s.queries[key] = queryCache
+		}
+		s.mutex.Unlock()
+	}
+	serveCached(w, r, queryCache, publicMaxAge(s.maxAge()))
+}
+
+func (s *Server) tilesHandler(w http.ResponseWriter, r *http.Request) {
+	if s.TilesPath == "" {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+	http.StripPrefix("/tiles/", http.FileServer(http.Dir(s.TilesPath))).ServeHTTP(w, r)
 }
 
-func (s *Server) scrape() error {
+// queryCoordinates reads the coordinates stored in the store.
+func (s *Server) queryCoordinates() (map[int]parken.Coordinates, error) {
+	s.dbMutex.Lock()
+	defer s.dbMutex.Unlock()
+	return s.Store().Coordinates()
+}
+
+// scrape obtains the current data and publishes it as the snapshot. Its outcome
+// is logged and recorded in the metrics.
+func (s *Server) scrape() (err error) {
+	outcome := "success"
+	logger := s.log().With("scrape_id", s.scrapeID.Add(1))
+	defer func(start time.Time) {
+		duration := time.Since(start)
+		s.recordScrape(start, err)
+		switch {
+		case err != nil:
+			outcome = "failure"
+			logger.Error("scraping failed", "duration", duration, "error", err)
+		case outcome == "no_update":
+			logger.Debug("no update", "duration", duration)
+		default:
+			logger.Info("scraped", "duration", duration, "updated", s.updated)
+		}
+		s.metrics.scrapes.WithLabelValues(outcome).Inc()
+		s.metrics.scrapeDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+	}(time.Now())
 	res, err := s.Scraper.Scrape(s.updated)
 	if err != nil {
 		if err == scraping.ErrNoUpdate {
+			outcome = "no_update"
 			return nil
 		}
 		return err
 	}
-	for i := 0; i < len(res.Parkings); i++ {
-		p := &res.Parkings[i]
-		if coordinates, ok := s.coordinates[p.ID]; ok {
-			p.Coordinates = coordinates
-		} else {
-			coordinates, err := s.obtainCoordinates(p)
-			if err != nil {
-				return err
-			}
-			s.coordinates[p.ID], p.Coordinates = coordinates, coordinates
-		}
+	var timeDB time.Time
+	s.dbMutex.Lock()
+	if s.Store() != nil && s.updated.IsZero() {
+		timeDB, err = s.Store().LatestUpdate()
 	}
-
-	cache, err := json.Marshal(res)
+	s.dbMutex.Unlock()
 	if err != nil {
 		return err
 	}
-	var timeDB time.Time
-	s.dbMutex.Lock()
-	if s.DB() != nil && s.updated.IsZero() {
-		row := s.DB().QueryRow("SELECT time FROM spots ORDER BY time DESC LIMIT 1;")
-		s.dbMutex.Unlock()
-		var updated string
-		err = row.Scan(&updated)
-		if err != sql.ErrNoRows {
-			if err != nil {
-				return err
-			}
-			timeDB, err = time.Parse(timeLayout, updated)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		s.dbMutex.Unlock()
-	}
 
-	s.updated, s.parkings, s.cache = res.Updated, res.Parkings, cache
+	// Parkings with unknown coordinates are published right away and updated
+	// once geocoding has finished.
+	s.mutex.Lock()
+	s.upstream = res.Parkings
+	res.Parkings = s.resolve(res.Parkings)
+	cache, err := newSnapshotCache(res)
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	s.setSnapshot(res, cache)
+	s.mutex.Unlock()
 	s.dbMutex.Lock()
 	defer s.dbMutex.Unlock()
-	if s.DB() != nil && timeDB.IsZero() || s.updated.After(timeDB) {
-		for i := 0; i < len(res.Parkings); i++ {
-			if _, err := s.insertSpotsStmt.Exec(res.Parkings[i].ID,
-				res.Updated.Format(timeLayout), res.Parkings[i].Spots); err != nil {
-				return err
-			}
+	if s.Store() != nil && (timeDB.IsZero() || s.updated.After(timeDB)) {
+		start := time.Now()
+		err := s.Store().SaveSpots(res.Updated, res.Parkings)
+		s.metrics.recordInsert("spots", start, err)
+		if err != nil {
+			return err
+		}
+		if err := s.recordMetadata(res.Updated, res.Parkings); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func (s *Server) DB() *sql.DB {
-	return s.db
+// Store returns the store of the history, which is nil if the server has none.
+func (s *Server) Store() store.Store {
+	return s.store
 }
 
-func (s *Server) SetDB(db *sql.DB) error {
-	closeStatements := func() {
-		if s.DB() != nil {
-			s.insertCoordinatesStmt.Close()
-			s.insertSpotsStmt.Close()
-		}
-	}
+// SetStore replaces the store of the history. The previous store is not
+// closed.
+func (s *Server) SetStore(st store.Store) {
+	// The reconstructed snapshots are reset once the store is released.
+	defer func() {
+		s.mutex.Lock()
+		s.pastQueries = nil
+		s.mutex.Unlock()
+	}()
 	s.dbMutex.Lock()
 	defer s.dbMutex.Unlock()
-	if db == nil {
-		closeStatements()
-		s.db = nil
-		return nil
-	}
-	insertCoordinatesStmt, err := db.Prepare("INSERT INTO coordinates (parking_id, latitude, longitude) VALUES (?, ?, ?);")
-	if err != nil {
-		return err
-	}
-	insertSpotsStmt, err := db.Prepare("INSERT INTO spots (parking_id, time, free) VALUES (?, ?, ?);")
-	if err != nil {
-		return err
+	s.store, s.metadata = st, nil
+}
+
+// setInterval records the scraping interval, which determines the time of the
+// next scrape after each tick.
+func (s *Server) setInterval(interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.interval = interval
+	if interval == 0 {
+		s.nextScrape = time.Time{}
+	} else {
+		s.nextScrape = time.Now().Add(interval)
 	}
-	closeStatements()
-	s.db, s.insertCoordinatesStmt, s.insertSpotsStmt = db, insertCoordinatesStmt, insertSpotsStmt
-	return nil
 }
 
 func (s *Server) ScheduleScraping(interval time.Duration) {
+	s.setInterval(interval)
 	if interval == 0 {
 		if s.ticker != nil {
 			s.ticker.Stop()
@@ -260,17 +460,18 @@ func (s *Server) ScheduleScraping(interval time.Duration) {
 
 	s.ticker = time.NewTicker(interval)
 	s.done = make(chan struct{})
+	ticker, done := s.ticker, s.done
 	go func() {
 		for {
 			select {
-			case <-s.ticker.C:
+			case t := <-ticker.C:
+				s.mutex.Lock()
+				s.nextScrape = t.Add(s.interval)
+				s.mutex.Unlock()
 				go func() {
-					err := s.scrape()
-					if err != nil {
-						s.logln("scraping:", err)
-					}
+					s.scrape()
 				}()
-			case <-s.done:
+			case <-done:
 				return
 			}
 		}
@@ -279,49 +480,79 @@ func (s *Server) ScheduleScraping(interval time.Duration) {
 
 func (s *Server) Close() error {
 	s.ScheduleScraping(0)
+	s.stopGeocoding()
 	return s.Server.Close()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.ScheduleScraping(0)
+	s.stopGeocoding()
 	return s.Server.Shutdown(ctx)
 }
 
-func NewServer(httpServer *http.Server, scraper *scraping.Scraper, scrapingInterval time.Duration, presets map[int]parken.Coordinates, client *nominatim.Client, db *sql.DB, logger *log.Logger) (*Server, error) {
+// NewServer creates a server serving the frontend from the given file system.
+func NewServer(httpServer *http.Server, frontend fs.FS, scraper *scraping.Scraper, scrapingInterval time.Duration, presets map[int]parken.Coordinates, client *nominatim.Client, st store.Store, logger *slog.Logger) (*Server, error) {
 	if httpServer == nil {
 		httpServer = &http.Server{}
 	}
 	mux := http.NewServeMux()
 	httpServer.Handler = mux
+	// dirty
+	mime.AddExtensionType(".ttf", "font/ttf")
+	assets, err := newAssets(frontend)
+	if err != nil {
+		return nil, fmt.Errorf("loading assets: %w", err)
+	}
 	if client == nil {
 		client = &nominatim.Client{}
 	}
-	server := &Server{Server: httpServer, Scraper: scraper, coordinates: make(map[int]parken.Coordinates), presets: presets, Client: client, Logger: logger}
+	server := &Server{Server: httpServer, Scraper: scraper, coordinates: make(map[int]parken.Coordinates), addresses: make(map[int]parken.Address), pending: make(map[int]bool), overrides: make(map[int]override), ipLimiter: newLimiter(), keyLimiter: newLimiter(), usage: newUsage(), stream: newStream(), presets: presets, Client: client, Logger: logger}
 
-	if db != nil {
-		if err := server.SetDB(db); err != nil {
+	if st != nil {
+		server.SetStore(st)
+		if server.coordinatesDB, err = server.queryCoordinates(); err != nil {
 			return nil, err
 		}
-		if err := server.queryCoordinates(); err != nil {
+		if server.overrides, err = server.queryOverrides(); err != nil {
 			return nil, err
 		}
 	}
 
+	server.newMetrics()
+	server.startGeocoding()
 	if err := server.scrape(); err != nil {
 		return nil, fmt.Errorf("scraping: %w", err)
 	}
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
-			httpError(w, http.StatusNotFound)
-			return
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, server.instrument(pattern, handler, false))
+	}
+	// api registers a route of the public API with and without the version
+	// prefixes. The routes are subject to CORS, quotas and rate limits.
+	api := func(pattern string, handler http.HandlerFunc, stream bool) {
+		for _, prefix := range []string{"/api", apiPrefix, apiV2Prefix} {
+			mux.Handle(prefix+pattern, server.instrument(prefix+pattern, server.cors(server.limit(prefix+pattern, handler)), stream))
 		}
-		http.ServeFile(w, r, "frontend/index.html")
-	})
-	mux.HandleFunc("/api/parkings", server.parkingsHandler)
-	// dirty
-	mime.AddExtensionType(".ttf", "font/ttf")
-	mux.Handle("/static/", http.StripPrefix("/static/", compressedFileServer(http.Dir("frontend"), []string{".html", ".css", ".js", ".ttf"})))
-	mux.Handle("/tiles/", http.StripPrefix("/tiles/", http.FileServer(http.Dir("tiles"))))
+	}
+	api("/parkings", server.parkingsHandler, false)
+	api("/parkings/", server.parkingHandler, false)
+	api("/zones", server.zonesHandler, false)
+	api("/zones/", server.zoneHandler, false)
+	api("/stream", server.streamHandler, true)
+	handle("/api/openapi.json", server.cors(openAPIHandler(publishedOpenAPI)))
+	handle(apiPrefix+"/openapi.json", server.cors(openAPIHandler(publishedOpenAPI)))
+	handle(apiV2Prefix+"/openapi.json", server.cors(openAPIHandler(publishedOpenAPIV2)))
+	handle("/api/status", server.statusHandler)
+	handle("/healthz", healthHandler)
+	handle("/readyz", server.readyHandler)
+	handle("/admin/reload", server.admin(server.reloadHandler))
+	handle("/admin/overrides", server.admin(server.overridesHandler))
+	handle("/admin/overrides/", server.admin(server.overrideHandler))
+	handle("/admin/audit", server.admin(server.auditHandler))
+	handle("/admin/usage", server.admin(server.usageHandler))
+	mux.Handle("/metrics", server.metrics.handler)
+	handle("/", assets.indexHandler)
+	handle("/static/", assets.staticHandler)
+	handle("/tiles/", server.tilesHandler)
 
 	server.ScheduleScraping(scrapingInterval)
 
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/relseah/parken"
+	"github.com/relseah/parken/nominatim"
+	"github.com/relseah/parken/scraping"
+)
+
+var testUpdated = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+// newTestServer returns a server without store and scraper whose snapshot
+// consists of the given parkings. Its handlers are called directly.
+func newTestServer(t *testing.T, parkings ...parken.Parking) *Server {
+	t.Helper()
+	s := &Server{coordinates: make(map[int]parken.Coordinates), addresses: make(map[int]parken.Address),
+		pending: make(map[int]bool), overrides: make(map[int]override), ipLimiter: newLimiter(),
+		keyLimiter: newLimiter(), usage: newUsage(), stream: newStream(), Client: &nominatim.Client{}}
+	s.newMetrics()
+	s.setTestSnapshot(t, testUpdated, parkings...)
+	return s
+}
+
+// setTestSnapshot replaces the snapshot of the server as a scrape would.
+func (s *Server) setTestSnapshot(t *testing.T, updated time.Time, parkings ...parken.Parking) {
+	t.Helper()
+	res := scraping.Result{Updated: updated, Zones: map[int]string{1: "Altstadt"}, Parkings: parkings}
+	cache, err := newSnapshotCache(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mutex.Lock()
+	s.setSnapshot(res, cache)
+	s.mutex.Unlock()
+}
+
+// serve calls the handler with a GET request of the target and the given
+// header fields, which are passed as name-value pairs.
+func serve(handler http.HandlerFunc, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
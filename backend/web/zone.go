@@ -0,0 +1,111 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/relseah/parken"
+)
+
+type zoneTotals struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+	Spots    int    `json:"spots"`
+	// OccupancyPercentage is the percentage of occupied spots.
+	OccupancyPercentage float64 `json:"occupancyPercentage"`
+	Parkings            int     `json:"parkings"`
+	// OpenParkings counts the parkings that are not closed according to their
+	// opening hours.
+	OpenParkings int `json:"openParkings"`
+}
+
+func (t *zoneTotals) add(p *parken.Parking, now time.Time) {
+	t.Capacity += p.Capacity
+	t.Spots += p.Spots
+	t.Parkings++
+	if open, known := openAt(p, now); open || !known {
+		t.OpenParkings++
+	}
+	t.OccupancyPercentage = 100 * occupancy(t.Spots, t.Capacity)
+}
+
+type zoneResponse struct {
+	Updated time.Time `json:"updated"`
+	zoneTotals
+	ParkingIDs []int        `json:"parkingIds"`
+	Links      parkingLinks `json:"links"`
+}
+
+// zoneSnapshot returns the totals of all zones and of the whole city, which
+// serve as an occupancy index.
+func (s *Server) zoneSnapshot(now time.Time) (time.Time, zoneTotals, map[int]*zoneTotals, map[int][]int) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	city := zoneTotals{Name: "Heidelberg"}
+	zones := make(map[int]*zoneTotals, len(s.zones))
+	members := make(map[int][]int, len(s.zones))
+	for id, name := range s.zones {
+		zones[id] = &zoneTotals{ID: id, Name: name}
+	}
+	for i := range s.parkings {
+		p := &s.parkings[i]
+		t, ok := zones[p.Zone]
+		if !ok {
+			t = &zoneTotals{ID: p.Zone}
+			zones[p.Zone] = t
+		}
+		t.add(p, now)
+		city.add(p, now)
+		members[p.Zone] = append(members[p.Zone], p.ID)
+	}
+	return s.updated, city, zones, members
+}
+
+type zonesResponse struct {
+	Updated time.Time    `json:"updated"`
+	City    zoneTotals   `json:"city"`
+	Zones   []zoneTotals `json:"zones"`
+}
+
+func (s *Server) zonesHandler(w http.ResponseWriter, r *http.Request) {
+	updated, city, zones, _ := s.zoneSnapshot(time.Now())
+	list := make([]zoneTotals, 0, len(zones))
+	for _, t := range zones {
+		list = append(list, *t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	s.writeAPI(w, r, zonesResponse{updated, city, list})
+}
+
+// zoneHandler serves /api/zones/{id} and the summed up history of the zone's
+// parkings at /api/zones/{id}/history.
+func (s *Server) zoneHandler(w http.ResponseWriter, r *http.Request) {
+	prefix, path := apiPath(r)
+	segments := strings.Split(strings.TrimPrefix(path, "/zones/"), "/")
+	id, err := strconv.Atoi(segments[0])
+	if err != nil || len(segments) > 2 || len(segments) == 2 && segments[1] != "history" {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+	updated, _, zones, members := s.zoneSnapshot(time.Now())
+	t, ok := zones[id]
+	if !ok {
+		httpError(w, http.StatusNotFound)
+		return
+	}
+	if len(segments) == 2 {
+		s.serveHistory(w, r, id, members[id])
+		return
+	}
+	self := fmt.Sprintf("%s/zones/%d", prefix, id)
+	res := zoneResponse{Updated: updated, zoneTotals: *t, ParkingIDs: members[id], Links: parkingLinks{Self: self, History: self + "/history"}}
+	if res.ParkingIDs == nil {
+		res.ParkingIDs = []int{}
+	}
+	s.writeAPI(w, r, res)
+}